@@ -0,0 +1,48 @@
+package breaker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const defaultBackoffMultiplier float64 = 2
+const defaultBackoffMax time.Duration = time.Hour * 24 * 365
+
+// Backoff computes open state duration when circuit opens again from half open state
+type Backoff interface {
+	// Duration returns open state duration from OpenStateDuration base, for the amount of consecutive reopenings.
+	// Level is 0 when circuit opens from closed state
+	Duration(base time.Duration, level int) time.Duration
+}
+
+// ExponentialBackoff multiplies open state duration on each reopening from half open state
+type ExponentialBackoff struct {
+	// Multiplier applied to open state duration on each reopening. 2 by default
+	Multiplier float64
+	// Max open state duration. 1 year by default, so open state expiration time never overflows
+	Max time.Duration
+	// Jitter ratio of open state duration randomly added to it, from 0 to 1. Disabled by default
+	Jitter float64
+}
+
+// Duration returns base multiplied by Multiplier level times, with Jitter, up to Max
+func (eb *ExponentialBackoff) Duration(base time.Duration, level int) time.Duration {
+	multiplier := eb.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultBackoffMultiplier
+	}
+
+	limit := float64(defaultBackoffMax)
+	if eb.Max > 0 {
+		limit = float64(eb.Max)
+	}
+
+	// Capped before jitter, as high levels overflow to infinity
+	duration := math.Min(float64(base)*math.Pow(multiplier, float64(level)), limit)
+	if eb.Jitter > 0 {
+		duration += duration * eb.Jitter * rand.Float64()
+	}
+
+	return time.Duration(math.Min(duration, limit))
+}
@@ -0,0 +1,44 @@
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff_Duration(t *testing.T) {
+	backoff := &breaker.ExponentialBackoff{}
+
+	assert.Equal(t, time.Second, backoff.Duration(time.Second, 0))
+	assert.Equal(t, time.Second*2, backoff.Duration(time.Second, 1))
+	assert.Equal(t, time.Second*8, backoff.Duration(time.Second, 3))
+
+	backoff = &breaker.ExponentialBackoff{
+		Multiplier: 3,
+		Max:        time.Second * 5,
+	}
+
+	assert.Equal(t, time.Second*3, backoff.Duration(time.Second, 1))
+	assert.Equal(t, time.Second*5, backoff.Duration(time.Second, 2))
+
+	backoff = &breaker.ExponentialBackoff{
+		Jitter: 0.5,
+		Max:    time.Second * 5,
+	}
+
+	for i := 0; i < 100; i++ {
+		duration := backoff.Duration(time.Second, 1)
+		assert.GreaterOrEqual(t, int64(duration), int64(time.Second*2))
+		assert.Less(t, int64(duration), int64(time.Second*3))
+
+		assert.Equal(t, time.Second*5, backoff.Duration(time.Second, 3))
+	}
+
+	backoff = &breaker.ExponentialBackoff{Jitter: 0.5}
+
+	for _, level := range []int{29, 30, 64, 2000} {
+		assert.Equal(t, time.Hour*24*365, backoff.Duration(time.Second*10, level))
+	}
+}
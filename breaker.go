@@ -1,79 +1,716 @@
 package breaker
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/pkg/errors"
 )
 
 const defaultMaxFailures int = 10
 const defaultOpenStateDuration time.Duration = time.Second * 10
+const defaultHalfOpenMaxRequests int = 1
+const defaultHalfOpenSuccesses int = 1
+const defaultWindowBuckets int = 10
+const defaultWindowSize time.Duration = time.Minute
+const defaultMinimumRequests int = 10
+const defaultWatchInterval time.Duration = time.Second
+const defaultReportTimeout time.Duration = time.Second
 
 // Options Circuit breaker settings.
 type Options struct {
-	// MaxFailure amount to open the circuit from open state. 10 failures by default
+	// Name identifies the circuit breaker in errors
+	Name string
+	// MaxFailure amount to open the circuit from open state. 10 failures by default.
+	// Failures are consecutive ones, or the ones in the last WindowSize if set
 	MaxFailures int
 	// OpenStateDuration time to move from open to half open state
 	OpenStateDuration time.Duration
+	// OpenStateBackoff increases OpenStateDuration each time circuit opens again from half open state.
+	// Closing the circuit resets it. Disabled by default
+	OpenStateBackoff Backoff
+	// HalfOpenMaxRequests amount of concurrent requests allowed during half open state. 1 by default.
+	// Requests not reported within OpenStateDuration stop counting
+	HalfOpenMaxRequests int
+	// HalfOpenSuccesses amount of consecutive successes during half open state to close the circuit. 1 by default
+	HalfOpenSuccesses int
+	// WindowSize period of time to count successes and failures on closed state. Disabled by default
+	WindowSize time.Duration
+	// WindowBuckets amount of buckets WindowSize is split into. 10 by default
+	WindowBuckets int
+	// FailureRateThreshold ratio of failures in time window to open the circuit, from 0 to 1. Disabled by default.
+	// WindowSize is 1 minute by default when set
+	FailureRateThreshold float64
+	// SlowCallThreshold duration from which calls are slow. Slow calls count as failures. Disabled by default
+	SlowCallThreshold time.Duration
+	// SlowCallRateThreshold ratio of slow calls in time window to open the circuit, from 0 to 1. Disabled by default.
+	// WindowSize is 1 minute by default when set
+	SlowCallRateThreshold float64
+	// MinimumRequests amount of requests in time window before rate thresholds are checked. 10 by default
+	MinimumRequests int
+	// IsFailure decides which errors returned by controlled logic count as failures. All errors by default.
+	// Errors not counted as failures count as successes. Panics are always failures
+	IsFailure func(err error) bool
+	// TripStrategy decides when circuit opens, replacing MaxFailures and rate thresholds options.
+	// Time window counts are only available when WindowSize is set
+	TripStrategy TripStrategy
+	// RefreshState makes Ready load state from storage, so transitions made by other instances or operators are
+	// taken into account. Disabled by default
+	RefreshState bool
+	// RefreshInterval period state loaded by RefreshState is cached for. Loaded on every Ready by default
+	RefreshInterval time.Duration
+	// WatchInterval period to poll storage state on Watch, when storage changes can not be watched. 1 second by default
+	WatchInterval time.Duration
+	// ReportTimeout bounds the time Execute and Do wait for storage to count the result of fn, which is counted
+	// even if ctx is done. 1 second by default
+	ReportTimeout time.Duration
+	// Clock used to measure time. Real clock by default
+	Clock clock.Clock
+	// OnStateChange is called when circuit breaker moves from one state to another.
+	// Hooks get the context of the call causing the event, so metrics and traces can be correlated
+	OnStateChange func(ctx context.Context, name string, from, to State)
+	// OnSuccess is called when a success is reported
+	OnSuccess func(ctx context.Context, name string)
+	// OnFailure is called when a failure is reported, with the error that caused it.
+	// Error is SlowCallError for slow calls without error, and nil for failures reported by Fail
+	OnFailure func(ctx context.Context, name string, err error)
+	// OnRejected is called when a request is not allowed, with the RejectionError returned to caller
+	OnRejected func(ctx context.Context, name string, err *RejectionError)
 }
 
-// Breaker Circuit braker pattern implementation
+// Breaker Circuit braker pattern implementation. It is safe for concurrent use
 type Breaker struct {
-	// State current circuit braker state. It implements State iterface
-	State             State
-	storageService    Storage
-	openStateDuration time.Duration
-	maxFailures       int
+	mu             sync.RWMutex
+	state          State
+	storageService Storage
+	options        Options
+	refreshedAt    int64
+	transitioning  int32
 }
 
-// New implements Breaker factory
+// New implements Breaker factory.
+// It fails with UnsupportedStorageError if options need a storage feature it does not implement
 func New(storageService Storage, options *Options) (*Breaker, error) {
-	maxFailures := defaultMaxFailures
-	openStateDuration := defaultOpenStateDuration
-
-	if options != nil {
-		if options.MaxFailures > 0 {
-			maxFailures = options.MaxFailures
-		}
-
-		if options.OpenStateDuration > time.Second*0 {
-			openStateDuration = options.OpenStateDuration
-		}
+	o := newOptions(options)
+	if err := o.supportedBy(storageService); err != nil {
+		return nil, errors.Wrap(err, "NewBreaker")
 	}
 
-	currentState, err := storageService.GetCurrentState()
+	currentState, err := storageService.GetCurrentState(context.Background())
 
 	return &Breaker{
-		State:             currentState,
-		storageService:    storageService,
-		maxFailures:       maxFailures,
-		openStateDuration: openStateDuration,
+		state:          o.restore(currentState),
+		storageService: storageService,
+		options:        o,
 	}, errors.Wrap(err, "NewBreaker -> Closed state by default")
 }
 
-// Ready checks if circuit if closed, else returns a OpenCircuitError error
+// newOptions returns a copy of options, using default values for unset ones
+func newOptions(options *Options) Options {
+	o := Options{
+		MaxFailures:         defaultMaxFailures,
+		OpenStateDuration:   defaultOpenStateDuration,
+		HalfOpenMaxRequests: defaultHalfOpenMaxRequests,
+		HalfOpenSuccesses:   defaultHalfOpenSuccesses,
+		WindowBuckets:       defaultWindowBuckets,
+		MinimumRequests:     defaultMinimumRequests,
+		WatchInterval:       defaultWatchInterval,
+		ReportTimeout:       defaultReportTimeout,
+		Clock:               clock.New(),
+	}
+
+	if options == nil {
+		return o
+	}
+
+	o.Name = options.Name
+	o.RefreshState = options.RefreshState
+	o.RefreshInterval = options.RefreshInterval
+	o.OpenStateBackoff = options.OpenStateBackoff
+	o.TripStrategy = options.TripStrategy
+	o.IsFailure = options.IsFailure
+	o.OnStateChange = options.OnStateChange
+	o.OnSuccess = options.OnSuccess
+	o.OnFailure = options.OnFailure
+	o.OnRejected = options.OnRejected
+
+	o = withStates(o, options)
+	o = withWindow(o, options)
+	o = withSync(o, options)
+
+	return withRates(o, options)
+}
+
+// withStates sets failures and states options
+func withStates(o Options, options *Options) Options {
+	if options.MaxFailures > 0 {
+		o.MaxFailures = options.MaxFailures
+	}
+
+	if options.OpenStateDuration > time.Second*0 {
+		o.OpenStateDuration = options.OpenStateDuration
+	}
+
+	if options.HalfOpenMaxRequests > 0 {
+		o.HalfOpenMaxRequests = options.HalfOpenMaxRequests
+	}
+
+	if options.HalfOpenSuccesses > 0 {
+		o.HalfOpenSuccesses = options.HalfOpenSuccesses
+	}
+
+	return o
+}
+
+// withWindow sets time window and slow call options
+func withWindow(o Options, options *Options) Options {
+	if options.WindowSize > 0 {
+		o.WindowSize = options.WindowSize
+	}
+
+	if options.WindowBuckets > 0 {
+		o.WindowBuckets = options.WindowBuckets
+	}
+
+	if options.SlowCallThreshold > 0 {
+		o.SlowCallThreshold = options.SlowCallThreshold
+	}
+
+	return o
+}
+
+// withSync sets options to keep state in sync with storage, report results and measure time
+func withSync(o Options, options *Options) Options {
+	if options.WatchInterval > 0 {
+		o.WatchInterval = options.WatchInterval
+	}
+
+	if options.ReportTimeout > 0 {
+		o.ReportTimeout = options.ReportTimeout
+	}
+
+	if options.Clock != nil {
+		o.Clock = options.Clock
+	}
+
+	return o
+}
+
+// withRates sets failure and slow call rate options. Time window is enabled if needed
+func withRates(o Options, options *Options) Options {
+	if options.FailureRateThreshold <= 0 && options.SlowCallRateThreshold <= 0 {
+		return o
+	}
+
+	o.FailureRateThreshold = options.FailureRateThreshold
+	o.SlowCallRateThreshold = options.SlowCallRateThreshold
+
+	if options.MinimumRequests > 0 {
+		o.MinimumRequests = options.MinimumRequests
+	}
+
+	if o.WindowSize == 0 {
+		o.WindowSize = defaultWindowSize
+	}
+
+	return o
+}
+
+// getClock returns Clock option, or real clock if not set
+func (o *Options) getClock() clock.Clock {
+	if o.Clock == nil {
+		return clock.New()
+	}
+
+	return o.Clock
+}
+
+// restore returns persisted state measuring time with Clock option, as storages restore open states with real clock
+func (o *Options) restore(persisted State) State {
+	if open, ok := persisted.(*Open); ok {
+		return NewOpenUntil(o.getClock(), open.Until())
+	}
+
+	return persisted
+}
+
+// supportedBy checks storage implements WindowStorage and BackoffStorage when options need them
+func (o *Options) supportedBy(sr Storage) error {
+	if _, ok := sr.(WindowStorage); !ok && o.windowEnabled() {
+		return errors.Wrap(UnsupportedStorageError, "WindowSize")
+	}
+
+	if _, ok := sr.(BackoffStorage); !ok && o.OpenStateBackoff != nil {
+		return errors.Wrap(UnsupportedStorageError, "OpenStateBackoff")
+	}
+
+	return nil
+}
+
+// getTripStrategy returns TripStrategy option, or the one built from MaxFailures and rate thresholds if not set
+func (o *Options) getTripStrategy() TripStrategy {
+	if o.TripStrategy != nil {
+		return o.TripStrategy
+	}
+
+	strategies := append([]TripStrategy{o.failuresStrategy()}, o.rateStrategies()...)
+	if len(strategies) == 1 {
+		return strategies[0]
+	}
+
+	return AnyOf(strategies...)
+}
+
+// failuresStrategy returns the strategy checking MaxFailures, in time window if enabled
+func (o *Options) failuresStrategy() TripStrategy {
+	if o.windowEnabled() {
+		return WindowFailures(o.MaxFailures)
+	}
+
+	return ConsecutiveFailures(o.MaxFailures)
+}
+
+// rateStrategies returns the strategies checking failure and slow call rate thresholds if set
+func (o *Options) rateStrategies() []TripStrategy {
+	var strategies []TripStrategy
+	if o.FailureRateThreshold > 0 {
+		strategies = append(strategies, FailureRate(o.FailureRateThreshold, o.MinimumRequests))
+	}
+
+	if o.SlowCallRateThreshold > 0 {
+		strategies = append(strategies, SlowCallRate(o.SlowCallRateThreshold, o.MinimumRequests))
+	}
+
+	return strategies
+}
+
+// isFailure checks if err counts as failure using IsFailure option
+func (o *Options) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var panicErr *PanicError
+	if o.IsFailure == nil || errors.As(err, &panicErr) {
+		return true
+	}
+
+	return o.IsFailure(err)
+}
+
+// isSlowCall checks if a call taking elapsed time is slow
+func (o *Options) isSlowCall(elapsed time.Duration) bool {
+	return o.SlowCallThreshold > 0 && elapsed >= o.SlowCallThreshold
+}
+
+// windowEnabled checks if successes and failures are counted in a time window
+func (o *Options) windowEnabled() bool {
+	return o.WindowSize > 0
+}
+
+// windowBuckets returns current window bucket and the oldest bucket still in window
+func (o *Options) windowBuckets() (current int64, oldest int64) {
+	buckets := o.WindowBuckets
+	if buckets <= 0 {
+		buckets = defaultWindowBuckets
+	}
+
+	bucketSize := int64(o.WindowSize) / int64(buckets)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+
+	current = o.getClock().Now().UnixNano() / bucketSize
+
+	return current, current - int64(buckets) + 1
+}
+
+// Ready checks if circuit if closed, else returns a RejectionError matching OpenCircuitError.
+// During half open state, requests over HalfOpenMaxRequests get a RejectionError matching TooManyRequestsError
 func (b *Breaker) Ready() error {
-	nextState, _ := b.State.Next(b.storageService, b.maxFailures)
-	b.State = nextState
-	err := b.State.OnEntry(b.storageService, b.openStateDuration)
+	return b.ReadyContext(context.Background())
+}
 
-	if !b.State.Ready() {
-		return OpenCircuitError
+// ReadyContext is the context aware version of Ready. Context is passed to storage service.
+func (b *Breaker) ReadyContext(ctx context.Context) error {
+	b.refresh(ctx)
+
+	currentState := b.State()
+	nextState, _ := currentState.Next(ctx, b.storageService, &b.options)
+	state, err := b.transition(ctx, currentState, nextState)
+
+	if !state.Ready() {
+		return b.rejection(ctx, state, OpenCircuitError)
+	}
+
+	if halfOpen, ok := state.(*HalfOpen); ok && !halfOpen.acquire(&b.options) {
+		return b.rejection(ctx, state, TooManyRequestsError)
 	}
 
 	return errors.Wrap(err, "Ready -> Closed state by default")
 }
 
+// Name returns circuit breaker name
+func (b *Breaker) Name() string {
+	return b.options.Name
+}
+
+// rejection returns a RejectionError for a request rejected during state, notifying OnRejected hook
+func (b *Breaker) rejection(ctx context.Context, state State, err circuitError) *RejectionError {
+	rejection := &RejectionError{
+		Name:  b.options.Name,
+		State: state,
+		err:   err,
+	}
+
+	if open, ok := state.(*Open); ok {
+		rejection.RetryAt = open.Until()
+	}
+
+	if b.options.OnRejected != nil {
+		b.options.OnRejected(ctx, b.options.Name, rejection)
+	}
+
+	return rejection
+}
+
+// State returns current circuit breaker state
+func (b *Breaker) State() State {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.state
+}
+
+// transition moves circuit breaker from current to next state, unless another goroutine or instance moved it before.
+// Storage is called without holding the lock, so only one goroutine transitions at a time and the others keep
+// current state instead of waiting. Returns circuit breaker state after transition
+func (b *Breaker) transition(ctx context.Context, current, next State) (State, error) {
+	if next == current {
+		return current, nil
+	}
+
+	if !b.begin(current) {
+		return b.State(), nil
+	}
+
+	state, claimed, err := b.claim(ctx, current, next)
+	if entryErr := b.enter(ctx, state, next, claimed); entryErr != nil {
+		err = entryErr
+	}
+
+	state, swapped := b.swap(current, state)
+	atomic.StoreInt32(&b.transitioning, 0)
+
+	if swapped {
+		b.notifyStateChange(ctx, current, state)
+	}
+
+	return state, err
+}
+
+// begin claims the transition from current state for this goroutine.
+// Returns false if another goroutine is moving circuit breaker, or moved it before
+func (b *Breaker) begin(current State) bool {
+	if !atomic.CompareAndSwapInt32(&b.transitioning, 0, 1) {
+		return false
+	}
+
+	if b.State() == current {
+		return true
+	}
+	atomic.StoreInt32(&b.transitioning, 0)
+
+	return false
+}
+
+// swap replaces current state by next, unless it was replaced meanwhile by a persisted one.
+// Returns circuit breaker state and whether it was swapped
+func (b *Breaker) swap(current, next State) (State, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != current {
+		return b.state, false
+	}
+	b.state = next
+
+	return next, true
+}
+
+// enter runs entry side effects of state. States claimed through AtomicStorage only run the ones not done by it.
+// Else OnEntry of next state is run, unless another instance moved circuit breaker to state before
+func (b *Breaker) enter(ctx context.Context, state, next State, claimed bool) error {
+	if entry, ok := state.(atomicEntry); ok && claimed {
+		return entry.onAtomicEntry(ctx, b.storageService, &b.options)
+	}
+
+	if state != next {
+		return nil
+	}
+
+	return next.OnEntry(ctx, b.storageService, &b.options)
+}
+
+// claim moves persisted state from current to next if storage is an AtomicStorage, else next is returned.
+// Returns persisted state, which is not claimed when another instance moved circuit breaker before.
+// Storage errors are returned along with next, falling back to non atomic transitions
+func (b *Breaker) claim(ctx context.Context, current, next State) (State, bool, error) {
+	atomicStorage, ok := b.storageService.(AtomicStorage)
+	if !ok {
+		return next, false, nil
+	}
+
+	// Open state period is known before the transition, so other instances never get a different one
+	to := next
+	if open, ok := next.(*Open); ok {
+		to = open.starting(ctx, atomicStorage, &b.options)
+	}
+
+	state, err := atomicStorage.TransitionState(ctx, current, to)
+	if err != nil {
+		return next, false, errors.Wrap(err, "Transition")
+	}
+
+	if state != to {
+		return b.options.restore(state), false, nil
+	}
+
+	return state, true, nil
+}
+
+// notifyStateChange calls OnStateChange hook if state kind changed
+func (b *Breaker) notifyStateChange(ctx context.Context, from, to State) {
+	if b.options.OnStateChange != nil && from.String() != to.String() {
+		b.options.OnStateChange(ctx, b.options.Name, from, to)
+	}
+}
+
+// Watch keeps circuit breaker state in sync with storage until ctx is done, so transitions made by other instances
+// sharing the storage take effect here too. It blocks, so it is usually run in its own goroutine.
+// Changes are received from WatchableStorage if available. Else, or when watching fails, storage is polled every
+// WatchInterval. Returns ctx error
+func (b *Breaker) Watch(ctx context.Context) error {
+	if watchable, ok := b.storageService.(WatchableStorage); ok {
+		_ = watchable.Watch(ctx, func(state State) {
+			b.adopt(ctx, state)
+		})
+	}
+
+	return b.poll(ctx)
+}
+
+// poll adopts persisted state every WatchInterval until ctx is done. Returns ctx error
+func (b *Breaker) poll(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	ticker := b.options.getClock().Ticker(b.options.WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			b.load(ctx)
+		}
+	}
+}
+
+// load adopts persisted state. Storage errors are ignored, keeping current state
+func (b *Breaker) load(ctx context.Context) {
+	if state, err := b.storageService.GetCurrentState(ctx); err == nil {
+		b.adopt(ctx, state)
+	}
+}
+
+// refresh adopts persisted state when RefreshState option is set, unless it was loaded less than RefreshInterval ago.
+// Storage errors are ignored, keeping current state
+func (b *Breaker) refresh(ctx context.Context) {
+	if b.options.RefreshState && b.shouldRefresh() {
+		b.load(ctx)
+	}
+}
+
+// shouldRefresh checks if RefreshInterval elapsed since state was loaded, claiming the refresh.
+// Only one goroutine gets true for each interval. Always true without RefreshInterval
+func (b *Breaker) shouldRefresh() bool {
+	if b.options.RefreshInterval <= 0 {
+		return true
+	}
+
+	now := b.options.getClock().Now().UnixNano()
+	refreshedAt := atomic.LoadInt64(&b.refreshedAt)
+	if refreshedAt != 0 && now-refreshedAt < int64(b.options.RefreshInterval) {
+		return false
+	}
+
+	return atomic.CompareAndSwapInt64(&b.refreshedAt, refreshedAt, now)
+}
+
+// adopt replaces circuit breaker state by persisted one, moved by another instance.
+// OnEntry is not called, as storage is already up to date
+func (b *Breaker) adopt(ctx context.Context, persisted State) {
+	persisted = b.options.restore(persisted)
+
+	b.mu.Lock()
+	current := b.state
+	if sameState(current, persisted) {
+		b.mu.Unlock()
+
+		return
+	}
+	b.state = persisted
+	b.mu.Unlock()
+
+	b.notifyStateChange(ctx, current, persisted)
+}
+
+// sameState checks if both states are the same kind. Open states must expire at the same time too
+func sameState(a, b State) bool {
+	if a.String() != b.String() {
+		return false
+	}
+
+	openA, ok := a.(*Open)
+	if !ok {
+		return true
+	}
+
+	return openA.Until().Equal(b.(*Open).Until())
+}
+
 // Success method to be called when controlled logic by circuit breaker works propertly.
 func (b *Breaker) Success() error {
-	err := b.State.OnSuccess(b.storageService)
+	return b.SuccessContext(context.Background())
+}
+
+// SuccessContext is the context aware version of Success. Context is passed to storage service.
+func (b *Breaker) SuccessContext(ctx context.Context) error {
+	err := b.State().OnSuccess(ctx, b.storageService, &b.options)
+
+	if b.options.OnSuccess != nil {
+		b.options.OnSuccess(ctx, b.options.Name)
+	}
 
 	return errors.Wrap(err, "Success")
 }
 
 // Fail method to be called when controlled logic by circuit breaker fails.
 func (b *Breaker) Fail() error {
-	err := b.State.OnFail(b.storageService)
+	return b.FailContext(context.Background())
+}
+
+// FailContext is the context aware version of Fail. Context is passed to storage service.
+func (b *Breaker) FailContext(ctx context.Context) error {
+	return b.fail(ctx, nil)
+}
+
+// fail counts a failure caused by cause, notifying OnFailure hook
+func (b *Breaker) fail(ctx context.Context, cause error) error {
+	err := b.State().OnFail(ctx, b.storageService, &b.options)
+
+	b.notifyFailure(ctx, cause)
 
 	return errors.Wrap(err, "Fail")
 }
+
+// notifyFailure calls OnFailure hook if set
+func (b *Breaker) notifyFailure(ctx context.Context, cause error) {
+	if b.options.OnFailure != nil {
+		b.options.OnFailure(ctx, b.options.Name, cause)
+	}
+}
+
+// Done method to be called with the result of controlled logic by circuit breaker and the time it took.
+// Calls taking longer than SlowCallThreshold count as failures, else it works as Success or Fail depending on err.
+// Only errors accepted by IsFailure option count as failures
+func (b *Breaker) Done(elapsed time.Duration, err error) error {
+	return b.DoneContext(context.Background(), elapsed, err)
+}
+
+// DoneContext is the context aware version of Done. Context is passed to storage service.
+func (b *Breaker) DoneContext(ctx context.Context, elapsed time.Duration, err error) error {
+	if !b.options.isSlowCall(elapsed) {
+		if b.options.isFailure(err) {
+			return b.fail(ctx, err)
+		}
+
+		return b.SuccessContext(ctx)
+	}
+
+	cause := err
+	if cause == nil {
+		cause = SlowCallError
+	}
+
+	err = b.State().OnSlowCall(ctx, b.storageService, &b.options)
+	b.notifyFailure(ctx, cause)
+
+	return errors.Wrap(err, "SlowCall")
+}
+
+// Execute runs fn if circuit is ready, calling Done with its result and duration.
+// Returns a RejectionError without running fn when circuit does not allow it.
+// A panic in fn is recovered, counted as failure and returned as PanicError.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Do(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+
+	return err
+}
+
+// Do is the value returning version of Breaker.Execute
+func Do[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	if err = b.ReadyContext(ctx); isRejection(err) {
+		return result, err
+	}
+
+	start := b.options.Clock.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+			b.done(ctx, start, err)
+		}
+	}()
+
+	result, err = fn(ctx)
+	b.done(ctx, start, err)
+
+	return result, err
+}
+
+// done updates counters with the result of the logic controlled by circuit breaker, started at start time.
+// Storage errors are ignored: controlled logic result is more relevant to caller.
+// Counters are updated even if ctx is done, as timeouts are failures too, for up to ReportTimeout.
+func (b *Breaker) done(ctx context.Context, start time.Time, err error) {
+	elapsed := b.options.Clock.Since(start)
+
+	reportCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, b.options.ReportTimeout)
+	defer cancel()
+
+	_ = b.DoneContext(reportCtx, elapsed, err)
+}
+
+// detachedContext keeps parent values but is never done, so counters are updated after parent is cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+// Deadline returns no deadline
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done returns a nil channel, as detachedContext is never done
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err always returns nil
+func (detachedContext) Err() error { return nil }
+
+// Value returns parent value for key
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
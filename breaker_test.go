@@ -1,14 +1,22 @@
 package breaker_test
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/benbjohnson/clock"
 	"github.com/francisco-alejandro/breaker"
+	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestBreaker_Ready(t *testing.T) {
+	ctx := context.Background()
 	storageService := breaker.NewMemoryStorage()
 
 	options := breaker.Options{
@@ -22,16 +30,239 @@ func TestBreaker_Ready(t *testing.T) {
 	err = b.Ready()
 	assert.NoError(t, err)
 
-	err = storageService.IncrementFailures()
+	err = storageService.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
 	err = b.Ready()
 	assert.Error(t, err, "breaker: open circuit")
 }
 
+type writesCounter struct {
+	*breaker.MemoryStorage
+	writes      int64
+	stateWrites int64
+}
+
+func (wc *writesCounter) SetCurrentState(ctx context.Context, state breaker.State) error {
+	atomic.AddInt64(&wc.writes, 1)
+	atomic.AddInt64(&wc.stateWrites, 1)
+
+	return wc.MemoryStorage.SetCurrentState(ctx, state)
+}
+
+func (wc *writesCounter) IncrementFailures(ctx context.Context) error {
+	atomic.AddInt64(&wc.writes, 1)
+
+	return wc.MemoryStorage.IncrementFailures(ctx)
+}
+
+func (wc *writesCounter) Clear(ctx context.Context) error {
+	atomic.AddInt64(&wc.writes, 1)
+
+	return wc.MemoryStorage.Clear(ctx)
+}
+
+func TestBreaker_ReadyWrites(t *testing.T) {
+	storageService := &writesCounter{MemoryStorage: breaker.NewMemoryStorage()}
+
+	options := breaker.Options{
+		MaxFailures:       2,
+		OpenStateDuration: time.Minute,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = b.Ready()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(0), storageService.writes)
+
+	err = b.Fail()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	failures, err := storageService.GetFailures(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	err = b.Fail()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+	storageService.writes = 0
+	for i := 0; i < 10; i++ {
+		err = b.Ready()
+		assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	}
+	assert.Equal(t, int64(0), storageService.writes)
+}
+
+func TestBreaker_FailureRate(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+
+	options := breaker.Options{
+		MaxFailures:          100,
+		FailureRateThreshold: 0.5,
+		MinimumRequests:      10,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = b.Ready()
+		assert.NoError(t, err)
+
+		if i%2 == 0 {
+			err = b.Fail()
+		} else {
+			err = b.Success()
+		}
+		assert.NoError(t, err)
+	}
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+}
+
+func TestBreaker_Done(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	ctx := context.Background()
+
+	options := breaker.Options{
+		MaxFailures:       2,
+		SlowCallThreshold: time.Second,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = b.Done(time.Millisecond, nil)
+	assert.NoError(t, err)
+
+	err = b.Done(time.Millisecond, errors.New("service not available"))
+	assert.NoError(t, err)
+
+	failures, err := storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	err = b.DoneContext(ctx, time.Second, nil)
+	assert.NoError(t, err)
+
+	failures, err = storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+}
+
+func TestBreaker_SlowCallRate(t *testing.T) {
+	clockMock := clock.NewMock()
+	storageService := breaker.NewMemoryStorage()
+	ctx := context.Background()
+
+	options := breaker.Options{
+		MaxFailures:           100,
+		SlowCallThreshold:     time.Second,
+		SlowCallRateThreshold: 0.5,
+		MinimumRequests:       4,
+		Clock:                 clockMock,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		err = b.Execute(ctx, func(_ context.Context) error {
+			if i%2 == 0 {
+				clockMock.Add(time.Second * 2)
+			}
+
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	counts, err := storageService.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 2, Failures: 2, SlowCalls: 2}, counts)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+}
+
+func TestBreaker_OpenStateBackoff(t *testing.T) {
+	clockMock := clock.NewMock()
+	storageService := breaker.NewMemoryStorage()
+
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Second,
+		OpenStateBackoff:  &breaker.ExponentialBackoff{Max: time.Second * 3},
+		Clock:             clockMock,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = b.Fail()
+	assert.NoError(t, err)
+
+	for _, duration := range []time.Duration{time.Second, time.Second * 2, time.Second * 3} {
+		err = b.Ready()
+		assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+		clockMock.Add(duration - time.Millisecond)
+		err = b.Ready()
+		assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+		clockMock.Add(time.Millisecond)
+		err = b.Ready()
+		assert.NoError(t, err)
+
+		err = b.Fail()
+		assert.NoError(t, err)
+	}
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+	clockMock.Add(time.Second * 3)
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	err = b.Success()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	_, ok := b.State().(*breaker.Closed)
+	assert.True(t, ok)
+
+	err = b.Fail()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+	clockMock.Add(time.Second)
+	err = b.Ready()
+	assert.NoError(t, err)
+}
+
 func TestBreaker_Success(t *testing.T) {
+	ctx := context.Background()
 	storageService := breaker.NewMemoryStorage()
-	err := storageService.SetCurrentState(breaker.NewHalfOpen())
+	err := storageService.SetCurrentState(ctx, breaker.NewHalfOpen())
 	assert.NoError(t, err)
 
 	b, err := breaker.New(storageService, nil)
@@ -43,13 +274,97 @@ func TestBreaker_Success(t *testing.T) {
 	err = b.Ready()
 	assert.NoError(t, err)
 
-	_, ok := b.State.(*breaker.Closed)
+	_, ok := b.State().(*breaker.Closed)
 	assert.True(t, ok)
 }
 
+// baseStorage implements Storage without optional interfaces
+type baseStorage struct {
+	breaker.Storage
+}
+
+func TestBreaker_BaseStorage(t *testing.T) {
+	storageService := baseStorage{breaker.NewMemoryStorage()}
+
+	_, err := breaker.New(storageService, &breaker.Options{WindowSize: time.Minute})
+	assert.ErrorIs(t, err, breaker.UnsupportedStorageError)
+
+	_, err = breaker.New(storageService, &breaker.Options{OpenStateBackoff: &breaker.ExponentialBackoff{}})
+	assert.ErrorIs(t, err, breaker.UnsupportedStorageError)
+
+	b, err := breaker.New(storageService, &breaker.Options{MaxFailures: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Fail())
+	assert.ErrorIs(t, b.Ready(), breaker.OpenCircuitError)
+}
+
+func TestBreaker_HalfOpenMaxRequests(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	err := storageService.SetCurrentState(context.Background(), breaker.NewHalfOpen())
+	assert.NoError(t, err)
+
+	options := breaker.Options{
+		HalfOpenMaxRequests: 2,
+		HalfOpenSuccesses:   3,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.TooManyRequestsError))
+
+	for i := 0; i < 2; i++ {
+		err = b.Success()
+		assert.NoError(t, err)
+	}
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	_, ok := b.State().(*breaker.HalfOpen)
+	assert.True(t, ok)
+
+	err = b.Success()
+	assert.NoError(t, err)
+
+	err = b.Ready()
+	assert.NoError(t, err)
+
+	_, ok = b.State().(*breaker.Closed)
+	assert.True(t, ok)
+}
+
+func TestBreaker_HalfOpenUnreportedRequest(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	err := storageService.SetCurrentState(context.Background(), breaker.NewHalfOpen())
+	assert.NoError(t, err)
+
+	clockMock := clock.NewMock()
+	b, err := breaker.New(storageService, &breaker.Options{OpenStateDuration: time.Minute, Clock: clockMock})
+	assert.NoError(t, err)
+
+	// Trial request is never reported
+	assert.NoError(t, b.Ready())
+	assert.ErrorIs(t, b.Ready(), breaker.TooManyRequestsError)
+
+	clockMock.Add(time.Minute)
+	assert.NoError(t, b.Ready())
+	assert.NoError(t, b.Success())
+	assert.NoError(t, b.Ready())
+	assert.IsType(t, &breaker.Closed{}, b.State())
+}
+
 func TestBreaker_Fail(t *testing.T) {
+	ctx := context.Background()
 	storageService := breaker.NewMemoryStorage()
-	err := storageService.SetCurrentState(breaker.NewHalfOpen())
+	err := storageService.SetCurrentState(ctx, breaker.NewHalfOpen())
 	assert.NoError(t, err)
 
 	b, err := breaker.New(storageService, nil)
@@ -61,7 +376,7 @@ func TestBreaker_Fail(t *testing.T) {
 	err = b.Ready()
 	assert.Error(t, err, "breaker: open circuit")
 
-	err = storageService.SetCurrentState(breaker.NewClosed())
+	err = storageService.SetCurrentState(ctx, breaker.NewClosed())
 	assert.NoError(t, err)
 
 	options := breaker.Options{
@@ -77,3 +392,600 @@ func TestBreaker_Fail(t *testing.T) {
 	err = b.Ready()
 	assert.Error(t, err, "breaker: open circuit")
 }
+
+func TestBreaker_ReadyContext(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+
+	options := breaker.Options{
+		MaxFailures: 1,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err = b.ReadyContext(ctx)
+	assert.NoError(t, err)
+
+	err = b.FailContext(ctx)
+	assert.NoError(t, err)
+
+	cancel()
+
+	err = b.ReadyContext(ctx)
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+	err = b.SuccessContext(ctx)
+	assert.NoError(t, err)
+}
+
+func TestBreaker_Execute(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	ctx := context.Background()
+
+	options := breaker.Options{
+		MaxFailures: 1,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = b.Execute(ctx, func(_ context.Context) error {
+		return errors.New("service not available")
+	})
+	assert.EqualError(t, err, "service not available")
+
+	failures, err := storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	err = storageService.Clear(ctx)
+	assert.NoError(t, err)
+
+	calls := 0
+	err = b.Execute(ctx, func(_ context.Context) error {
+		calls++
+		panic("unexpected")
+	})
+	var panicErr *breaker.PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "unexpected", panicErr.Value)
+
+	err = b.Execute(ctx, func(_ context.Context) error {
+		calls++
+		return nil
+	})
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	assert.Equal(t, 1, calls)
+}
+
+// hangingStorage blocks failure writes until their context is done
+type hangingStorage struct {
+	*breaker.MemoryStorage
+}
+
+func (hs *hangingStorage) IncrementFailures(ctx context.Context) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestBreaker_ExecuteReportTimeout(t *testing.T) {
+	b, err := breaker.New(&hangingStorage{breaker.NewMemoryStorage()}, &breaker.Options{ReportTimeout: time.Millisecond * 50})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	start := time.Now()
+	err = b.Execute(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Millisecond*500)
+}
+
+// blockingStorage blocks state writes until released, signaling when they start
+type blockingStorage struct {
+	*breaker.MemoryStorage
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStorage) SetCurrentState(ctx context.Context, state breaker.State) error {
+	bs.writing <- struct{}{}
+	<-bs.release
+
+	return bs.MemoryStorage.SetCurrentState(ctx, state)
+}
+
+func TestBreaker_TransitionWithoutLock(t *testing.T) {
+	storageService := &blockingStorage{
+		MemoryStorage: breaker.NewMemoryStorage(),
+		writing:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	b, err := breaker.New(storageService, &breaker.Options{MaxFailures: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, b.Fail())
+
+	tripped := make(chan error)
+	go func() {
+		tripped <- b.Ready()
+	}()
+	<-storageService.writing
+
+	// Other goroutines keep current state while storage is slow, within their deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	start := time.Now()
+	assert.NoError(t, b.ReadyContext(ctx))
+	assert.IsType(t, &breaker.Closed{}, b.State())
+	assert.Less(t, time.Since(start), time.Millisecond*500)
+
+	close(storageService.release)
+	assert.ErrorIs(t, <-tripped, breaker.OpenCircuitError)
+	assert.IsType(t, &breaker.Open{}, b.State())
+}
+
+func TestBreaker_ExecuteIsFailure(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	ctx := context.Background()
+	errNotFound := errors.New("not found")
+
+	options := breaker.Options{
+		MaxFailures: 1,
+		IsFailure:   breaker.Ignore(errNotFound),
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = b.Execute(ctx, func(_ context.Context) error {
+		return errNotFound
+	})
+	assert.Equal(t, errNotFound, err)
+
+	failures, err := storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	err = b.Execute(ctx, func(_ context.Context) error {
+		panic(errNotFound)
+	})
+	var panicErr *breaker.PanicError
+	assert.True(t, errors.As(err, &panicErr))
+
+	failures, err = storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+}
+
+func TestDo(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+	ctx := context.Background()
+
+	b, err := breaker.New(storageService, nil)
+	assert.NoError(t, err)
+
+	err = storageService.IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	value, err := breaker.Do(ctx, b, func(_ context.Context) (string, error) {
+		return "response", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "response", value)
+
+	failures, err := storageService.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	err = storageService.SetCurrentState(ctx, breaker.NewOpen(clock.NewMock()))
+	assert.NoError(t, err)
+
+	b, err = breaker.New(storageService, nil)
+	assert.NoError(t, err)
+
+	value, err = breaker.Do(ctx, b, func(_ context.Context) (string, error) {
+		return "response", nil
+	})
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	assert.Empty(t, value)
+}
+
+func TestBreaker_Concurrency(t *testing.T) {
+	storageService := breaker.NewMemoryStorage()
+
+	options := breaker.Options{
+		MaxFailures:       5,
+		OpenStateDuration: time.Millisecond,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				if err := b.Ready(); err != nil {
+					_ = b.State().String()
+
+					continue
+				}
+
+				if (g+i)%3 == 0 {
+					_ = b.Fail()
+				} else {
+					_ = b.Success()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestBreaker_ConcurrentTransition(t *testing.T) {
+	ctx := context.Background()
+	storageService := &writesCounter{MemoryStorage: breaker.NewMemoryStorage()}
+
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	err = storageService.IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	start := make(chan struct{})
+	var rejected int64
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			if errors.Is(b.ReadyContext(ctx), breaker.OpenCircuitError) {
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int64(50), rejected)
+	assert.Equal(t, int64(1), storageService.stateWrites)
+
+	_, ok := b.State().(*breaker.Open)
+	assert.True(t, ok)
+}
+
+func TestBreaker_Hooks(t *testing.T) {
+	clockMock := clock.NewMock()
+	var transitions []string
+	var successes, rejections int
+	var failures []error
+
+	options := breaker.Options{
+		Name:              "payments",
+		MaxFailures:       2,
+		OpenStateDuration: time.Second,
+		SlowCallThreshold: time.Second,
+		Clock:             clockMock,
+		OnStateChange: func(_ context.Context, name string, from, to breaker.State) {
+			assert.Equal(t, "payments", name)
+			transitions = append(transitions, from.String()+" -> "+to.String())
+		},
+		OnSuccess: func(_ context.Context, name string) {
+			successes++
+		},
+		OnFailure: func(_ context.Context, name string, err error) {
+			failures = append(failures, err)
+		},
+		OnRejected: func(_ context.Context, name string, err *breaker.RejectionError) {
+			assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+			rejections++
+		},
+	}
+
+	b, err := breaker.New(breaker.NewMemoryStorage(), &options)
+	assert.NoError(t, err)
+
+	serviceErr := errors.New("service not available")
+	assert.NoError(t, b.Success())
+	assert.NoError(t, b.Done(time.Millisecond, serviceErr))
+	assert.NoError(t, b.Done(time.Second, nil))
+
+	err = b.Ready()
+	assert.Error(t, err)
+
+	clockMock.Add(time.Second)
+	assert.NoError(t, b.Ready())
+	assert.NoError(t, b.Success())
+	assert.NoError(t, b.Ready())
+
+	assert.Equal(t, []string{"closed -> open", "open -> half-open", "half-open -> closed"}, transitions)
+	assert.Equal(t, 2, successes)
+	assert.Equal(t, []error{serviceErr, breaker.SlowCallError}, failures)
+	assert.Equal(t, 1, rejections)
+}
+
+func TestBreaker_AtomicTransition(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+		OpenStateBackoff:  &breaker.ExponentialBackoff{},
+	}
+
+	// Each breaker plays an instance sharing the circuit
+	breakers := make([]*breaker.Breaker, 10)
+	for i := range breakers {
+		breakers[i], err = breaker.New(breaker.MustNewNamedRedisStorage(client, "payments", ""), &options)
+		assert.NoError(t, err)
+	}
+
+	err = breaker.MustNewNamedRedisStorage(client, "payments", "").IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, b := range breakers {
+		wg.Add(1)
+		go func(b *breaker.Breaker) {
+			defer wg.Done()
+			<-start
+
+			assert.True(t, errors.Is(b.ReadyContext(ctx), breaker.OpenCircuitError))
+		}(b)
+	}
+	close(start)
+	wg.Wait()
+
+	level, err := client.Get("breaker:{payments}:backoff_level").Int()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	state, err := client.Get("breaker:{payments}:state").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "open", state)
+}
+
+// entryStorage counts state and failures writes made outside AtomicStorage.TransitionState
+type entryStorage struct {
+	*breaker.RedisStorage
+	writes int
+}
+
+func (es *entryStorage) SetCurrentState(ctx context.Context, state breaker.State) error {
+	es.writes++
+
+	return es.RedisStorage.SetCurrentState(ctx, state)
+}
+
+func (es *entryStorage) Clear(ctx context.Context) error {
+	es.writes++
+
+	return es.RedisStorage.Clear(ctx)
+}
+
+func TestBreaker_AtomicEntry(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	clockMock := clock.NewMock()
+	clockMock.Set(time.Now())
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	storageService := &entryStorage{RedisStorage: breaker.MustNewNamedRedisStorage(client, "payments", "")}
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+		OpenStateBackoff:  &breaker.ExponentialBackoff{},
+		Clock:             clockMock,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	_, err = storageService.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Fail())
+	writes := storageService.writes
+
+	// Open state is persisted with its backed off period by the transition itself
+	assert.ErrorIs(t, b.Ready(), breaker.OpenCircuitError)
+	state, err := breaker.MustNewNamedRedisStorage(client, "payments", "").GetCurrentState(ctx)
+	assert.NoError(t, err)
+	open, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, clockMock.Now().Add(options.OpenStateBackoff.Duration(time.Minute, 1)).Equal(open.Until()))
+
+	level, err := storageService.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, level)
+
+	// Entries do not write state or failures again, so writes made by other instances meanwhile are kept
+	clockMock.Add(time.Hour)
+	assert.NoError(t, b.Ready())
+	assert.IsType(t, &breaker.HalfOpen{}, b.State())
+	assert.NoError(t, b.Success())
+	assert.NoError(t, b.Ready())
+	assert.IsType(t, &breaker.Closed{}, b.State())
+	assert.Equal(t, writes, storageService.writes)
+
+	level, err = storageService.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, level)
+}
+
+func TestBreaker_RestoredClock(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	// Clock option runs ahead of real time, so open states measured with real clock would not expire
+	clockMock := clock.NewMock()
+	clockMock.Set(time.Now().Add(time.Hour))
+	options := breaker.Options{
+		OpenStateDuration: time.Minute,
+		TripStrategy:      breaker.TripStrategyFunc(func(breaker.Counts) bool { return true }),
+		Clock:             clockMock,
+	}
+
+	// Loaded on creation
+	storageService := breaker.NewMemoryStorage()
+	err = storageService.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), clockMock.Now().Add(time.Minute)))
+	assert.NoError(t, err)
+	restored, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+
+	// Persisted by another instance winning the transition
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	winner, err := breaker.New(breaker.MustNewNamedRedisStorage(client, "payments", ""), &options)
+	assert.NoError(t, err)
+	loser, err := breaker.New(breaker.MustNewNamedRedisStorage(client, "payments", ""), &options)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, winner.Ready(), breaker.OpenCircuitError)
+	for _, b := range []*breaker.Breaker{restored, loser} {
+		assert.ErrorIs(t, b.Ready(), breaker.OpenCircuitError)
+	}
+
+	clockMock.Add(time.Minute * 2)
+	for _, b := range []*breaker.Breaker{restored, loser} {
+		assert.NoError(t, b.Ready())
+		assert.IsType(t, &breaker.HalfOpen{}, b.State())
+	}
+}
+
+func TestBreaker_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	var transitions int64
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+		OnStateChange: func(_ context.Context, _ string, _, _ breaker.State) {
+			atomic.AddInt64(&transitions, 1)
+		},
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tripped, err := breaker.New(breaker.MustNewNamedRedisStorage(client, "payments", ""), &options)
+	assert.NoError(t, err)
+	watcher, err := breaker.New(breaker.MustNewNamedRedisStorage(client, "payments", ""), &options)
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- watcher.Watch(ctx)
+	}()
+
+	// Wait for subscription before tripping
+	assert.Eventually(t, func() bool {
+		return mr.PubSubNumSub("breaker:{payments}:transitions")["breaker:{payments}:transitions"] == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, tripped.Fail())
+	assert.Error(t, tripped.Ready())
+
+	assert.Eventually(t, func() bool {
+		_, ok := watcher.State().(*breaker.Open)
+
+		return ok
+	}, time.Second, time.Millisecond)
+
+	err = watcher.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&transitions))
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+}
+
+func TestBreaker_WatchPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clockMock := clock.NewMock()
+	storageService := breaker.NewMemoryStorage()
+
+	b, err := breaker.New(storageService, &breaker.Options{WatchInterval: time.Second, Clock: clockMock})
+	assert.NoError(t, err)
+
+	go func() {
+		_ = b.Watch(ctx)
+	}()
+
+	err = storageService.SetCurrentState(ctx, breaker.NewOpenUntil(clockMock, clockMock.Now().Add(time.Minute)))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		clockMock.Add(time.Second)
+		_, ok := b.State().(*breaker.Open)
+
+		return ok
+	}, time.Second, time.Millisecond)
+
+	err = b.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+}
+
+func TestBreaker_RefreshState(t *testing.T) {
+	ctx := context.Background()
+	clockMock := clock.NewMock()
+	clockMock.Add(time.Hour)
+	storageService := breaker.NewMemoryStorage()
+
+	cached, err := breaker.New(storageService, &breaker.Options{Clock: clockMock})
+	assert.NoError(t, err)
+	refreshed, err := breaker.New(storageService, &breaker.Options{RefreshState: true, Clock: clockMock})
+	assert.NoError(t, err)
+	interval, err := breaker.New(storageService, &breaker.Options{
+		RefreshState:    true,
+		RefreshInterval: time.Second * 10,
+		Clock:           clockMock,
+	})
+	assert.NoError(t, err)
+
+	err = storageService.SetCurrentState(ctx, breaker.NewOpenUntil(clockMock, clockMock.Now().Add(time.Minute)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, cached.Ready())
+	assert.True(t, errors.Is(refreshed.Ready(), breaker.OpenCircuitError))
+	assert.True(t, errors.Is(interval.Ready(), breaker.OpenCircuitError))
+
+	err = storageService.SetCurrentState(ctx, breaker.NewClosed())
+	assert.NoError(t, err)
+
+	assert.NoError(t, refreshed.Ready())
+	assert.True(t, errors.Is(interval.Ready(), breaker.OpenCircuitError))
+
+	clockMock.Add(time.Second * 10)
+	assert.NoError(t, interval.Ready())
+}
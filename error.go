@@ -1,5 +1,12 @@
 package breaker
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 type circuitError string
 
 func (e circuitError) Error() string {
@@ -8,3 +15,71 @@ func (e circuitError) Error() string {
 
 // OpenCircuitError raises when circuit is open
 const OpenCircuitError = circuitError("breaker: open circuit")
+
+// TooManyRequestsError raises when circuit is half open and the amount of trial requests is exceeded
+const TooManyRequestsError = circuitError("breaker: too many requests")
+
+// SlowCallError is reported to OnFailure hook when a call without error takes longer than SlowCallThreshold
+const SlowCallError = circuitError("breaker: slow call")
+
+// InvalidNameError is the error of storage constructors given an empty name,
+// or a Redis storage name with braces, which would break its hash tag
+const InvalidNameError = circuitError("breaker: invalid storage name")
+
+// UnsupportedStorageError is returned by New when options need a storage feature, like WindowStorage for
+// WindowSize or BackoffStorage for OpenStateBackoff, not implemented by the storage
+const UnsupportedStorageError = circuitError("breaker: storage does not support options")
+
+// RejectionError is returned when circuit breaker does not allow a request.
+// It matches OpenCircuitError or TooManyRequestsError using errors.Is
+type RejectionError struct {
+	// Name of the circuit breaker
+	Name string
+	// State of the circuit breaker when the request was rejected
+	State State
+	// RetryAt is the time circuit is expected to go half open. Zero if unknown
+	RetryAt time.Time
+	err     circuitError
+}
+
+func (e *RejectionError) Error() string {
+	if e.Name == "" {
+		return e.err.Error()
+	}
+
+	return fmt.Sprintf("%s (%s)", e.err, e.Name)
+}
+
+// Unwrap returns OpenCircuitError or TooManyRequestsError
+func (e *RejectionError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter returns time left until RetryAt, to be used as Retry-After header. Zero if unknown or past
+func (e *RejectionError) RetryAfter() time.Duration {
+	if e.RetryAt.IsZero() {
+		return 0
+	}
+
+	retryAfter := time.Until(e.RetryAt)
+	if retryAfter < 0 {
+		return 0
+	}
+
+	return retryAfter
+}
+
+// isRejection checks if err was returned because circuit breaker did not allow a request
+func isRejection(err error) bool {
+	return errors.Is(err, OpenCircuitError) || errors.Is(err, TooManyRequestsError)
+}
+
+// PanicError is returned by Breaker.Execute when controlled logic panics
+type PanicError struct {
+	// Value recovered from panic
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("breaker: recovered panic: %v", e.Value)
+}
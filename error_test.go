@@ -1,7 +1,10 @@
 package breaker_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/francisco-alejandro/breaker"
 	"github.com/stretchr/testify/assert"
@@ -9,4 +12,46 @@ import (
 
 func TestCircuitError_Error(t *testing.T) {
 	assert.Equal(t, "breaker: open circuit", breaker.OpenCircuitError.Error())
+	assert.Equal(t, "breaker: too many requests", breaker.TooManyRequestsError.Error())
+}
+
+func TestPanicError_Error(t *testing.T) {
+	err := &breaker.PanicError{Value: "unexpected"}
+	assert.Equal(t, "breaker: recovered panic: unexpected", err.Error())
+}
+
+func TestRejectionError(t *testing.T) {
+	ctx := context.Background()
+	storageService := breaker.NewMemoryStorage()
+
+	err := storageService.IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	options := breaker.Options{
+		Name:              "payments",
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+	}
+
+	b, err := breaker.New(storageService, &options)
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", b.Name())
+
+	err = b.Ready()
+	assert.EqualError(t, err, "breaker: open circuit (payments)")
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	assert.False(t, errors.Is(err, breaker.TooManyRequestsError))
+
+	var rejection *breaker.RejectionError
+	assert.True(t, errors.As(err, &rejection))
+	assert.Equal(t, "payments", rejection.Name)
+	assert.Equal(t, b.State(), rejection.State)
+	assert.Equal(t, b.State().(*breaker.Open).Until(), rejection.RetryAt)
+	assert.InDelta(t, float64(time.Minute), float64(rejection.RetryAfter()), float64(time.Second))
+
+	rejection.RetryAt = time.Now().Add(-time.Second)
+	assert.Equal(t, time.Duration(0), rejection.RetryAfter())
+
+	rejection.RetryAt = time.Time{}
+	assert.Equal(t, time.Duration(0), rejection.RetryAfter())
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -18,8 +20,11 @@ func init() {
 	s := breaker.NewMemoryStorage()
 
 	options := breaker.Options{
+		Name:              "google",
 		MaxFailures:       1,
 		OpenStateDuration: time.Second * 1,
+		// Canceled requests and 4xx responses do not open the circuit
+		IsFailure: breaker.IgnoreAny(breaker.IgnoreCanceled, breaker.IgnoreHTTPClientErrors),
 	}
 
 	cb, err = breaker.New(s, &options)
@@ -31,7 +36,7 @@ func init() {
 // Get wraps http.Get in CircuitBreaker.
 func Get(url string) ([]byte, error) {
 	err := cb.Ready()
-	if err == breaker.OpenCircuitError {
+	if errors.Is(err, breaker.OpenCircuitError) || errors.Is(err, breaker.TooManyRequestsError) {
 		return nil, err
 	}
 
@@ -54,6 +59,28 @@ func Get(url string) ([]byte, error) {
 	return body, nil
 }
 
+// GetWithContext wraps http.Get in CircuitBreaker using breaker.Do.
+func GetWithContext(ctx context.Context, url string) ([]byte, error) {
+	return breaker.Do(ctx, cb, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &breaker.StatusError{Code: resp.StatusCode}
+		}
+
+		return ioutil.ReadAll(resp.Body)
+	})
+}
+
 func main() {
 	body, err := Get("http://www.google.com/robots.txt")
 	if err != nil {
@@ -61,4 +88,11 @@ func main() {
 	}
 
 	fmt.Println(string(body))
+
+	body, err = GetWithContext(context.Background(), "http://www.google.com/robots.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(string(body))
 }
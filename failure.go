@@ -0,0 +1,74 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// StatusCoder is implemented by errors carrying an HTTP status code
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// StatusError is an error for unexpected HTTP responses. It implements StatusCoder
+type StatusError struct {
+	// Code is the HTTP status code of the response
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("breaker: unexpected HTTP status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// StatusCode returns the HTTP status code of the response
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// Ignore returns an IsFailure option which does not count as failures errors matching any of targets.
+// Errors are matched using errors.Is
+func Ignore(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// IgnoreCanceled is an IsFailure option which does not count context.Canceled errors as failures
+func IgnoreCanceled(err error) bool {
+	return !errors.Is(err, context.Canceled)
+}
+
+// IgnoreHTTPClientErrors is an IsFailure option which does not count as failures errors carrying a 4xx HTTP status code.
+// Errors must implement StatusCoder
+func IgnoreHTTPClientErrors(err error) bool {
+	var statusCoder StatusCoder
+	if !errors.As(err, &statusCoder) {
+		return true
+	}
+
+	code := statusCoder.StatusCode()
+
+	return code < http.StatusBadRequest || code >= http.StatusInternalServerError
+}
+
+// IgnoreAny returns an IsFailure option which does not count err as failure if any of isFailure functions ignores it
+func IgnoreAny(isFailure ...func(error) bool) func(error) bool {
+	return func(err error) bool {
+		for _, fn := range isFailure {
+			if !fn(err) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
@@ -0,0 +1,53 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusError(t *testing.T) {
+	err := &breaker.StatusError{Code: http.StatusNotFound}
+
+	assert.Equal(t, "breaker: unexpected HTTP status 404 Not Found", err.Error())
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
+
+func TestIgnore(t *testing.T) {
+	errNotFound := errors.New("not found")
+	isFailure := breaker.Ignore(errNotFound, context.DeadlineExceeded)
+
+	assert.False(t, isFailure(errNotFound))
+	assert.False(t, isFailure(fmt.Errorf("get user: %w", errNotFound)))
+	assert.False(t, isFailure(context.DeadlineExceeded))
+	assert.True(t, isFailure(errors.New("service not available")))
+}
+
+func TestIgnoreCanceled(t *testing.T) {
+	assert.False(t, breaker.IgnoreCanceled(context.Canceled))
+	assert.False(t, breaker.IgnoreCanceled(fmt.Errorf("get user: %w", context.Canceled)))
+	assert.True(t, breaker.IgnoreCanceled(context.DeadlineExceeded))
+}
+
+func TestIgnoreHTTPClientErrors(t *testing.T) {
+	assert.False(t, breaker.IgnoreHTTPClientErrors(&breaker.StatusError{Code: http.StatusBadRequest}))
+	assert.False(t, breaker.IgnoreHTTPClientErrors(
+		fmt.Errorf("get user: %w", &breaker.StatusError{Code: http.StatusNotFound}),
+	))
+	assert.True(t, breaker.IgnoreHTTPClientErrors(&breaker.StatusError{Code: http.StatusServiceUnavailable}))
+	assert.True(t, breaker.IgnoreHTTPClientErrors(&breaker.StatusError{Code: http.StatusFound}))
+	assert.True(t, breaker.IgnoreHTTPClientErrors(errors.New("service not available")))
+}
+
+func TestIgnoreAny(t *testing.T) {
+	isFailure := breaker.IgnoreAny(breaker.IgnoreCanceled, breaker.IgnoreHTTPClientErrors)
+
+	assert.False(t, isFailure(context.Canceled))
+	assert.False(t, isFailure(&breaker.StatusError{Code: http.StatusNotFound}))
+	assert.True(t, isFailure(&breaker.StatusError{Code: http.StatusBadGateway}))
+}
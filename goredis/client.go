@@ -0,0 +1,138 @@
+// Package goredis adapts go-redis v9 clients to breaker.RedisClient, so RedisStorage can use them
+package goredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/redis/go-redis/v9"
+)
+
+// Client adapts a go-redis v9 client to breaker.RedisClient. Commands are cancelled when their context is done
+type Client struct {
+	client redis.UniversalClient
+}
+
+// NewClient returns a Client using client
+func NewClient(client redis.UniversalClient) *Client {
+	return &Client{client: client}
+}
+
+// NewStorage returns a RedisStorage object using client. With Cluster and Ring clients, set Name or HashTag
+// in options, so all keys of a circuit breaker go to the same slot.
+// It fails with InvalidNameError if Name has braces
+func NewStorage(client redis.UniversalClient, options *breaker.RedisOptions) (*breaker.RedisStorage, error) {
+	return breaker.NewRedisClientStorage(NewClient(client), options)
+}
+
+// Get returns key value
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", breaker.RedisNilError
+	}
+
+	return value, err
+}
+
+// Set sets key value
+func (c *Client) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Incr increments key value
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return c.client.Incr(ctx, key).Result()
+}
+
+// Del removes keys
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	return c.client.Del(ctx, keys...).Err()
+}
+
+// PExpire sets key TTL
+func (c *Client) PExpire(ctx context.Context, key string, ttl time.Duration) error {
+	return c.client.PExpire(ctx, key, ttl).Err()
+}
+
+// HIncrBy increments hash field value
+func (c *Client) HIncrBy(ctx context.Context, key, field string, increment int64) error {
+	return c.client.HIncrBy(ctx, key, field, increment).Err()
+}
+
+// HGetAll returns hash fields and values
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.client.HGetAll(ctx, key).Result()
+}
+
+// HDel removes hash fields
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	return c.client.HDel(ctx, key, fields...).Err()
+}
+
+// Eval runs Lua script
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.client.Eval(ctx, script, keys, args...).Result()
+}
+
+// EvalSha runs Lua script loaded in server
+func (c *Client) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.client.EvalSha(ctx, sha1, keys, args...).Result()
+}
+
+// Publish posts message on channel
+func (c *Client) Publish(ctx context.Context, channel string, message string) error {
+	return c.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe subscribes to channel, returning once subscription is confirmed
+func (c *Client) Subscribe(ctx context.Context, channel string) (breaker.RedisSubscription, error) {
+	pubsub := c.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+
+		return nil, err
+	}
+
+	subscription := &subscription{
+		pubsub:   pubsub,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go subscription.receive()
+
+	return subscription, nil
+}
+
+// subscription adapts go-redis v9 pub/sub to breaker.RedisSubscription
+type subscription struct {
+	pubsub   *redis.PubSub
+	messages chan string
+	done     chan struct{}
+}
+
+// receive forwards message payloads until subscription is closed
+func (s *subscription) receive() {
+	defer close(s.messages)
+
+	for message := range s.pubsub.Channel() {
+		select {
+		case s.messages <- message.Payload:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Messages returns a channel receiving published messages
+func (s *subscription) Messages() <-chan string {
+	return s.messages
+}
+
+// Close ends subscription
+func (s *subscription) Close() error {
+	close(s.done)
+
+	return s.pubsub.Close()
+}
@@ -0,0 +1,181 @@
+// Package otel integrates circuit breakers with OpenTelemetry.
+// Breaker decisions are added as events to the span in context, and outcomes are recorded as metrics
+package otel
+
+import (
+	"context"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/francisco-alejandro/breaker/otel"
+
+// DecisionEvent is the name of the span event added when a breaker allows or rejects a request
+const DecisionEvent = "breaker.decision"
+
+// Attribute keys used in span events and metrics
+const (
+	NameKey     = attribute.Key("breaker.name")
+	StateKey    = attribute.Key("breaker.state")
+	RejectedKey = attribute.Key("breaker.rejected")
+	OutcomeKey  = attribute.Key("breaker.outcome")
+	FromKey     = attribute.Key("breaker.from")
+	ToKey       = attribute.Key("breaker.to")
+)
+
+// Outcomes recorded in breaker.outcomes metric
+const (
+	OutcomeSuccess  = "success"
+	OutcomeFailure  = "failure"
+	OutcomeRejected = "rejected"
+)
+
+// Instrumentation records breaker outcomes and transitions as OpenTelemetry metrics. It is safe for concurrent use
+type Instrumentation struct {
+	outcomes    metric.Int64Counter
+	transitions metric.Int64Counter
+}
+
+// New creates an Instrumentation using meters from provider. Global meter provider is used if nil
+func New(provider metric.MeterProvider) (*Instrumentation, error) {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(instrumentationName)
+
+	outcomes, err := meter.Int64Counter("breaker.outcomes",
+		metric.WithDescription("Amount of requests by circuit breaker outcome: success, failure or rejected."))
+	if err != nil {
+		return nil, errors.Wrap(err, "New -> Int64Counter")
+	}
+
+	transitions, err := meter.Int64Counter("breaker.transitions",
+		metric.WithDescription("Amount of circuit breaker state transitions."))
+	if err != nil {
+		return nil, errors.Wrap(err, "New -> Int64Counter")
+	}
+
+	return &Instrumentation{
+		outcomes:    outcomes,
+		transitions: transitions,
+	}, nil
+}
+
+// Instrument returns a copy of options with hooks recording metrics with the context of the call causing them,
+// so they are correlated with its span. Hooks already set in options are still called
+func (i *Instrumentation) Instrument(options *breaker.Options) *breaker.Options {
+	o := breaker.Options{}
+	if options != nil {
+		o = *options
+	}
+
+	o.OnStateChange = i.onStateChange(o.OnStateChange)
+	o.OnSuccess = i.onSuccess(o.OnSuccess)
+	o.OnFailure = i.onFailure(o.OnFailure)
+	o.OnRejected = i.onRejected(o.OnRejected)
+
+	return &o
+}
+
+// onStateChange returns an OnStateChange hook recording transitions, then calling next
+func (i *Instrumentation) onStateChange(
+	next func(ctx context.Context, name string, from, to breaker.State),
+) func(ctx context.Context, name string, from, to breaker.State) {
+	return func(ctx context.Context, name string, from, to breaker.State) {
+		i.transitions.Add(ctx, 1, metric.WithAttributes(
+			NameKey.String(name), FromKey.String(from.String()), ToKey.String(to.String())))
+
+		if next != nil {
+			next(ctx, name, from, to)
+		}
+	}
+}
+
+// onSuccess returns an OnSuccess hook recording success outcomes, then calling next
+func (i *Instrumentation) onSuccess(next func(ctx context.Context, name string)) func(ctx context.Context, name string) {
+	return func(ctx context.Context, name string) {
+		i.outcome(ctx, name, OutcomeSuccess)
+
+		if next != nil {
+			next(ctx, name)
+		}
+	}
+}
+
+// onFailure returns an OnFailure hook recording failure outcomes, then calling next
+func (i *Instrumentation) onFailure(
+	next func(ctx context.Context, name string, err error),
+) func(ctx context.Context, name string, err error) {
+	return func(ctx context.Context, name string, err error) {
+		i.outcome(ctx, name, OutcomeFailure)
+
+		if next != nil {
+			next(ctx, name, err)
+		}
+	}
+}
+
+// onRejected returns an OnRejected hook recording rejected outcomes, then calling next
+func (i *Instrumentation) onRejected(
+	next func(ctx context.Context, name string, err *breaker.RejectionError),
+) func(ctx context.Context, name string, err *breaker.RejectionError) {
+	return func(ctx context.Context, name string, err *breaker.RejectionError) {
+		i.outcome(ctx, name, OutcomeRejected)
+
+		if next != nil {
+			next(ctx, name, err)
+		}
+	}
+}
+
+// outcome records an outcome of named circuit breaker
+func (i *Instrumentation) outcome(ctx context.Context, name string, outcome string) {
+	i.outcomes.Add(ctx, 1, metric.WithAttributes(NameKey.String(name), OutcomeKey.String(outcome)))
+}
+
+// Execute runs fn through Breaker.Execute, adding a DecisionEvent to the span in ctx
+func Execute(ctx context.Context, b *breaker.Breaker, fn func(ctx context.Context) error) error {
+	_, err := Do(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+
+	return err
+}
+
+// Do runs fn through breaker.Do, adding a DecisionEvent to the span in ctx
+func Do[T any](ctx context.Context, b *breaker.Breaker, fn func(ctx context.Context) (T, error)) (T, error) {
+	span := trace.SpanFromContext(ctx)
+	allowed := false
+
+	result, err := breaker.Do(ctx, b, func(ctx context.Context) (T, error) {
+		allowed = true
+		decision(span, b.Name(), b.State(), false)
+
+		return fn(ctx)
+	})
+
+	var rejection *breaker.RejectionError
+	if !allowed && errors.As(err, &rejection) {
+		decision(span, b.Name(), rejection.State, true)
+	}
+
+	return result, err
+}
+
+// decision adds a DecisionEvent to span
+func decision(span trace.Span, name string, state breaker.State, rejected bool) {
+	if !span.IsRecording() {
+		return
+	}
+
+	span.AddEvent(DecisionEvent, trace.WithAttributes(
+		NameKey.String(name),
+		StateKey.String(state.String()),
+		RejectedKey.Bool(rejected),
+	))
+}
@@ -0,0 +1,109 @@
+package otel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/francisco-alejandro/breaker/otel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDo(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	b, err := breaker.New(breaker.NewMemoryStorage(), &breaker.Options{Name: "payments", MaxFailures: 1})
+	assert.NoError(t, err)
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	result, err := otel.Do(ctx, b, func(_ context.Context) (int, error) {
+		return 0, errors.New("service not available")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, result)
+
+	err = otel.Execute(ctx, b, func(_ context.Context) error { return nil })
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	span.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+
+	events := spans[0].Events()
+	assert.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, otel.DecisionEvent, event.Name)
+	}
+	assert.Equal(t, []attribute.KeyValue{
+		otel.NameKey.String("payments"), otel.StateKey.String("closed"), otel.RejectedKey.Bool(false),
+	}, events[0].Attributes)
+	assert.Equal(t, []attribute.KeyValue{
+		otel.NameKey.String("payments"), otel.StateKey.String("open"), otel.RejectedKey.Bool(true),
+	}, events[1].Attributes)
+}
+
+func TestInstrumentation(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, span := tracer.Start(context.Background(), "request")
+	defer span.End()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	instrumentation, err := otel.New(provider)
+	assert.NoError(t, err)
+
+	var rejections int
+	options := instrumentation.Instrument(&breaker.Options{
+		Name:        "payments",
+		MaxFailures: 1,
+		OnRejected: func(ctx context.Context, _ string, _ *breaker.RejectionError) {
+			// Hooks get the context of the request, with its span
+			assert.Equal(t, span.SpanContext(), trace.SpanContextFromContext(ctx))
+			rejections++
+		},
+	})
+
+	b, err := breaker.New(breaker.NewMemoryStorage(), options)
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Execute(ctx, func(_ context.Context) error { return nil }))
+	assert.Error(t, b.Execute(ctx, func(_ context.Context) error { return errors.New("service not available") }))
+	assert.Error(t, b.Execute(ctx, func(_ context.Context) error { return nil }))
+	assert.Equal(t, 1, rejections)
+
+	data := metricdata.ResourceMetrics{}
+	assert.NoError(t, reader.Collect(ctx, &data))
+
+	sums := map[string]map[attribute.Distinct]int64{}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sums[m.Name] = map[attribute.Distinct]int64{}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				sums[m.Name][point.Attributes.Equivalent()] = point.Value
+			}
+		}
+	}
+
+	outcome := func(outcome string) attribute.Distinct {
+		set := attribute.NewSet(otel.NameKey.String("payments"), otel.OutcomeKey.String(outcome))
+
+		return set.Equivalent()
+	}
+	assert.Equal(t, map[attribute.Distinct]int64{
+		outcome(otel.OutcomeSuccess):  1,
+		outcome(otel.OutcomeFailure):  1,
+		outcome(otel.OutcomeRejected): 1,
+	}, sums["breaker.outcomes"])
+
+	transition := attribute.NewSet(otel.NameKey.String("payments"), otel.FromKey.String("closed"), otel.ToKey.String("open"))
+	assert.Equal(t, map[attribute.Distinct]int64{transition.Equivalent(): 1}, sums["breaker.transitions"])
+}
@@ -0,0 +1,158 @@
+// Package prometheus exposes circuit breaker metrics to Prometheus, collected through breaker event hooks
+package prometheus
+
+import (
+	"context"
+
+	"github.com/francisco-alejandro/breaker"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var states = []string{
+	breaker.NewClosed().String(),
+	breaker.NewOpen(nil).String(),
+	breaker.NewHalfOpen().String(),
+}
+
+// Collector is a prometheus.Collector with metrics of named circuit breakers. It is safe for concurrent use
+type Collector struct {
+	successes   *prom.CounterVec
+	failures    *prom.CounterVec
+	rejections  *prom.CounterVec
+	transitions *prom.CounterVec
+	state       *prom.GaugeVec
+}
+
+// NewCollector returns a Collector to be registered in a prometheus.Registerer.
+// Breakers are labeled by name, so they should have unique ones
+func NewCollector() *Collector {
+	return &Collector{
+		successes: prom.NewCounterVec(prom.CounterOpts{
+			Name: "breaker_successes_total",
+			Help: "Amount of successes reported to circuit breaker.",
+		}, []string{"name"}),
+		failures: prom.NewCounterVec(prom.CounterOpts{
+			Name: "breaker_failures_total",
+			Help: "Amount of failures reported to circuit breaker, slow calls included.",
+		}, []string{"name"}),
+		rejections: prom.NewCounterVec(prom.CounterOpts{
+			Name: "breaker_rejections_total",
+			Help: "Amount of requests not allowed by circuit breaker, by state.",
+		}, []string{"name", "state"}),
+		transitions: prom.NewCounterVec(prom.CounterOpts{
+			Name: "breaker_transitions_total",
+			Help: "Amount of circuit breaker state transitions.",
+		}, []string{"name", "from", "to"}),
+		state: prom.NewGaugeVec(prom.GaugeOpts{
+			Name: "breaker_state",
+			Help: "Current circuit breaker state. 1 for current state, 0 for the others.",
+		}, []string{"name", "state"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.successes.Describe(ch)
+	c.failures.Describe(ch)
+	c.rejections.Describe(ch)
+	c.transitions.Describe(ch)
+	c.state.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.successes.Collect(ch)
+	c.failures.Collect(ch)
+	c.rejections.Collect(ch)
+	c.transitions.Collect(ch)
+	c.state.Collect(ch)
+}
+
+// Instrument returns a copy of options with hooks updating collector metrics.
+// Hooks already set in options are still called
+func (c *Collector) Instrument(options *breaker.Options) *breaker.Options {
+	o := breaker.Options{}
+	if options != nil {
+		o = *options
+	}
+
+	o.OnStateChange = c.onStateChange(o.OnStateChange)
+	o.OnSuccess = c.onSuccess(o.OnSuccess)
+	o.OnFailure = c.onFailure(o.OnFailure)
+	o.OnRejected = c.onRejected(o.OnRejected)
+
+	return &o
+}
+
+// onStateChange returns an OnStateChange hook counting transitions and setting state gauge, then calling next
+func (c *Collector) onStateChange(next func(ctx context.Context, name string, from, to breaker.State)) func(ctx context.Context, name string, from, to breaker.State) {
+	return func(ctx context.Context, name string, from, to breaker.State) {
+		c.transitions.WithLabelValues(name, from.String(), to.String()).Inc()
+		c.setState(name, to)
+
+		if next != nil {
+			next(ctx, name, from, to)
+		}
+	}
+}
+
+// onSuccess returns an OnSuccess hook counting successes, then calling next
+func (c *Collector) onSuccess(next func(ctx context.Context, name string)) func(ctx context.Context, name string) {
+	return func(ctx context.Context, name string) {
+		c.successes.WithLabelValues(name).Inc()
+
+		if next != nil {
+			next(ctx, name)
+		}
+	}
+}
+
+// onFailure returns an OnFailure hook counting failures, then calling next
+func (c *Collector) onFailure(next func(ctx context.Context, name string, err error)) func(ctx context.Context, name string, err error) {
+	return func(ctx context.Context, name string, err error) {
+		c.failures.WithLabelValues(name).Inc()
+
+		if next != nil {
+			next(ctx, name, err)
+		}
+	}
+}
+
+// onRejected returns an OnRejected hook counting rejections by state, then calling next
+func (c *Collector) onRejected(next func(ctx context.Context, name string, err *breaker.RejectionError)) func(ctx context.Context, name string, err *breaker.RejectionError) {
+	return func(ctx context.Context, name string, err *breaker.RejectionError) {
+		c.rejections.WithLabelValues(name, err.State.String()).Inc()
+
+		if next != nil {
+			next(ctx, name, err)
+		}
+	}
+}
+
+// New creates a circuit breaker instrumented by collector. Current state is set from storage
+func (c *Collector) New(storageService breaker.Storage, options *breaker.Options) (*breaker.Breaker, error) {
+	b, err := breaker.New(storageService, c.Instrument(options))
+	if b != nil {
+		c.Register(b)
+	}
+
+	return b, err
+}
+
+// Register sets state gauge from current state of a circuit breaker instrumented elsewhere, like those of a Registry.
+// Later changes are set by hooks, so its options should come from Instrument
+func (c *Collector) Register(b *breaker.Breaker) {
+	c.setState(b.Name(), b.State())
+}
+
+// setState sets state gauge of named circuit breaker
+func (c *Collector) setState(name string, state breaker.State) {
+	for _, s := range states {
+		value := 0.0
+		if s == state.String() {
+			value = 1
+		}
+
+		c.state.WithLabelValues(name, s).Set(value)
+	}
+}
@@ -0,0 +1,128 @@
+package prometheus_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/francisco-alejandro/breaker"
+	"github.com/francisco-alejandro/breaker/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	clockMock := clock.NewMock()
+	collector := prometheus.NewCollector()
+
+	var transitions int
+	options := breaker.Options{
+		Name:              "payments",
+		MaxFailures:       1,
+		OpenStateDuration: time.Second,
+		Clock:             clockMock,
+		OnStateChange: func(_ context.Context, _ string, _, _ breaker.State) {
+			transitions++
+		},
+	}
+
+	b, err := collector.New(breaker.NewMemoryStorage(), &options)
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Execute(ctx, func(_ context.Context) error { return nil }))
+	err = b.Execute(ctx, func(_ context.Context) error { return errors.New("service not available") })
+	assert.Error(t, err)
+
+	err = b.Execute(ctx, func(_ context.Context) error { return nil })
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+
+	clockMock.Add(time.Second)
+	assert.NoError(t, b.Ready())
+
+	expected := `
+# HELP breaker_failures_total Amount of failures reported to circuit breaker, slow calls included.
+# TYPE breaker_failures_total counter
+breaker_failures_total{name="payments"} 1
+# HELP breaker_rejections_total Amount of requests not allowed by circuit breaker, by state.
+# TYPE breaker_rejections_total counter
+breaker_rejections_total{name="payments",state="open"} 1
+# HELP breaker_state Current circuit breaker state. 1 for current state, 0 for the others.
+# TYPE breaker_state gauge
+breaker_state{name="payments",state="closed"} 0
+breaker_state{name="payments",state="half-open"} 1
+breaker_state{name="payments",state="open"} 0
+# HELP breaker_successes_total Amount of successes reported to circuit breaker.
+# TYPE breaker_successes_total counter
+breaker_successes_total{name="payments"} 1
+# HELP breaker_transitions_total Amount of circuit breaker state transitions.
+# TYPE breaker_transitions_total counter
+breaker_transitions_total{from="closed",name="payments",to="open"} 1
+breaker_transitions_total{from="open",name="payments",to="half-open"} 1
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, transitions)
+}
+
+func TestCollector_New(t *testing.T) {
+	ctx := context.Background()
+	collector := prometheus.NewCollector()
+	storageService := breaker.NewMemoryStorage()
+
+	err := storageService.SetCurrentState(ctx, breaker.NewOpen(clock.New()))
+	assert.NoError(t, err)
+
+	_, err = collector.New(storageService, &breaker.Options{Name: "payments"})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP breaker_state Current circuit breaker state. 1 for current state, 0 for the others.
+# TYPE breaker_state gauge
+breaker_state{name="payments",state="closed"} 0
+breaker_state{name="payments",state="half-open"} 0
+breaker_state{name="payments",state="open"} 1
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected), "breaker_state")
+	assert.NoError(t, err)
+}
+
+func TestCollector_Register(t *testing.T) {
+	ctx := context.Background()
+	collector := prometheus.NewCollector()
+	registry := breaker.NewRegistry(&breaker.RegistryOptions{
+		Defaults: *collector.Instrument(&breaker.Options{MaxFailures: 1}),
+	})
+
+	cb, err := registry.Get("payments")
+	assert.NoError(t, err)
+
+	collector.Register(cb)
+
+	expected := `
+# HELP breaker_state Current circuit breaker state. 1 for current state, 0 for the others.
+# TYPE breaker_state gauge
+breaker_state{name="payments",state="closed"} 1
+breaker_state{name="payments",state="half-open"} 0
+breaker_state{name="payments",state="open"} 0
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected), "breaker_state")
+	assert.NoError(t, err)
+
+	err = cb.FailContext(ctx)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(cb.ReadyContext(ctx), breaker.OpenCircuitError))
+
+	expected = `
+# HELP breaker_state Current circuit breaker state. 1 for current state, 0 for the others.
+# TYPE breaker_state gauge
+breaker_state{name="payments",state="closed"} 0
+breaker_state{name="payments",state="half-open"} 0
+breaker_state{name="payments",state="open"} 1
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected), "breaker_state")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,258 @@
+// Package redigo adapts redigo connection pools to breaker.RedisClient, so RedisStorage can use them
+package redigo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// Client adapts a redigo pool to breaker.RedisClient. Each command borrows a connection from the pool
+type Client struct {
+	pool *redis.Pool
+}
+
+// NewClient returns a Client using pool
+func NewClient(pool *redis.Pool) *Client {
+	return &Client{pool: pool}
+}
+
+// NewStorage returns a RedisStorage object using pool.
+// It fails with InvalidNameError if Name has braces
+func NewStorage(pool *redis.Pool, options *breaker.RedisOptions) (*breaker.RedisStorage, error) {
+	return breaker.NewRedisClientStorage(NewClient(pool), options)
+}
+
+// do runs command on a connection borrowed from the pool
+func (c *Client) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+// Get returns key value
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	value, err := redis.String(c.do(ctx, "GET", key))
+	if err == redis.ErrNil {
+		return "", breaker.RedisNilError
+	}
+
+	return value, err
+}
+
+// Set sets key value
+func (c *Client) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	args := []interface{}{key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+
+	_, err := c.do(ctx, "SET", args...)
+
+	return err
+}
+
+// Incr increments key value
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.do(ctx, "INCR", key))
+}
+
+// Del removes keys
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	_, err := c.do(ctx, "DEL", redis.Args{}.AddFlat(keys)...)
+
+	return err
+}
+
+// PExpire sets key TTL
+func (c *Client) PExpire(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := c.do(ctx, "PEXPIRE", key, ttl.Milliseconds())
+
+	return err
+}
+
+// HIncrBy increments hash field value
+func (c *Client) HIncrBy(ctx context.Context, key, field string, increment int64) error {
+	_, err := c.do(ctx, "HINCRBY", key, field, increment)
+
+	return err
+}
+
+// HGetAll returns hash fields and values
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return redis.StringMap(c.do(ctx, "HGETALL", key))
+}
+
+// HDel removes hash fields
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	_, err := c.do(ctx, "HDEL", redis.Args{}.Add(key).AddFlat(fields)...)
+
+	return err
+}
+
+// Eval runs Lua script. Bulk strings in result are returned as strings
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.eval(ctx, "EVAL", script, keys, args...)
+}
+
+// EvalSha runs Lua script loaded in server. Bulk strings in result are returned as strings
+func (c *Client) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.eval(ctx, "EVALSHA", sha1, keys, args...)
+}
+
+func (c *Client) eval(ctx context.Context, cmd, script string, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := c.do(ctx, cmd, redis.Args{}.Add(script, len(keys)).AddFlat(keys).Add(args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(result), nil
+}
+
+// toStrings converts bulk strings in reply to strings, like go-redis does
+func toStrings(reply interface{}) interface{} {
+	switch value := reply.(type) {
+	case []byte:
+		return string(value)
+	case []interface{}:
+		values := make([]interface{}, len(value))
+		for i, v := range value {
+			values[i] = toStrings(v)
+		}
+
+		return values
+	default:
+		return value
+	}
+}
+
+// Publish posts message on channel
+func (c *Client) Publish(ctx context.Context, channel string, message string) error {
+	_, err := c.do(ctx, "PUBLISH", channel, message)
+
+	return err
+}
+
+// Subscribe subscribes to channel on a connection borrowed from the pool until subscription is closed.
+// Returns once subscription is confirmed
+func (c *Client) Subscribe(ctx context.Context, channel string) (breaker.RedisSubscription, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pubsub := redis.PubSubConn{Conn: conn}
+	err = pubsub.Subscribe(channel)
+	if err == nil {
+		err = confirm(pubsub.ReceiveContext(ctx))
+	}
+
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	subscription := &subscription{
+		pubsub:   pubsub,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go subscription.receive()
+
+	return subscription, nil
+}
+
+// confirm checks reply is a subscription confirmation
+func confirm(reply interface{}) error {
+	switch value := reply.(type) {
+	case redis.Subscription:
+		return nil
+	case error:
+		return value
+	default:
+		return errors.Errorf("unexpected reply %v", reply)
+	}
+}
+
+// subscription adapts redigo pub/sub connection to breaker.RedisSubscription
+type subscription struct {
+	mu       sync.Mutex
+	closed   bool
+	pubsub   redis.PubSubConn
+	messages chan string
+	done     chan struct{}
+}
+
+// receive forwards message payloads until unsubscribed, closed or connection fails.
+// Connection is returned to the pool afterwards
+func (s *subscription) receive() {
+	defer close(s.messages)
+	defer s.release()
+
+	for {
+		if !s.forward(s.pubsub.Receive()) {
+			return
+		}
+	}
+}
+
+// forward sends message payload of reply to messages. Returns false when receiving must stop
+func (s *subscription) forward(reply interface{}) bool {
+	switch value := reply.(type) {
+	case redis.Message:
+		return s.send(string(value.Data))
+	case redis.Subscription:
+		return value.Count > 0
+	case error:
+		return false
+	default:
+		return true
+	}
+}
+
+// send sends payload to messages. Returns false if subscription is closed meanwhile
+func (s *subscription) send(payload string) bool {
+	select {
+	case s.messages <- payload:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// release returns connection to the pool
+func (s *subscription) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	_ = s.pubsub.Close()
+}
+
+// Messages returns a channel receiving published messages
+func (s *subscription) Messages() <-chan string {
+	return s.messages
+}
+
+// Close ends subscription
+func (s *subscription) Close() error {
+	close(s.done)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	return s.pubsub.Unsubscribe()
+}
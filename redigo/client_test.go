@@ -0,0 +1,91 @@
+package redigo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/francisco-alejandro/breaker"
+	"github.com/francisco-alejandro/breaker/redigo"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStorage(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	pool := newPool(mr.Addr())
+	defer pool.Close()
+
+	rs, err := redigo.NewStorage(pool, &breaker.RedisOptions{Name: "payments"})
+	assert.NoError(t, err)
+	b, err := breaker.New(rs, &breaker.Options{MaxFailures: 1, WindowSize: time.Minute})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.Success())
+	assert.NoError(t, b.Fail())
+	assert.True(t, errors.Is(b.Ready(), breaker.OpenCircuitError))
+
+	value, err := mr.Get("breaker:{payments}:state")
+	assert.NoError(t, err)
+	assert.Equal(t, "open", value)
+	assert.True(t, mr.Exists("breaker:{payments}:open_until"))
+
+	state, err := rs.GetCurrentState(ctx)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+
+	counts, err := rs.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 1, Failures: 1}, counts)
+
+	rs, err = redigo.NewStorage(pool, nil)
+	assert.NoError(t, err)
+	failures, err := rs.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	pool := newPool(mr.Addr())
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rs, err := redigo.NewStorage(pool, &breaker.RedisOptions{Name: "payments"})
+	assert.NoError(t, err)
+	states := make(chan breaker.State, 1)
+	go func() {
+		_ = rs.Watch(ctx, func(state breaker.State) {
+			states <- state
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return mr.PubSubNumSub("breaker:{payments}:transitions")["breaker:{payments}:transitions"] == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, rs.SetCurrentState(ctx, breaker.NewHalfOpen()))
+
+	_, ok := (<-states).(*breaker.HalfOpen)
+	assert.True(t, ok)
+}
+
+func newPool(addr string) *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+}
@@ -0,0 +1,282 @@
+package breaker
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// RedisNilError is returned by RedisClient when a key does not exist
+const RedisNilError = circuitError("breaker: redis nil")
+
+// RedisClient is the minimal Redis client used by RedisStorage, so it works with any client library.
+// go-redis v6 clients are adapted by NewRedisStorage. Packages goredis and redigo adapt go-redis v9 and redigo clients.
+// Implementations return RedisNilError from Get when key does not exist, and strings for bulk strings in Eval results
+type RedisClient interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+	Del(ctx context.Context, keys ...string) error
+	PExpire(ctx context.Context, key string, ttl time.Duration) error
+	HIncrBy(ctx context.Context, key, field string, increment int64) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error)
+	Publish(ctx context.Context, channel string, message string) error
+	// Subscribe returns once subscription to channel is confirmed
+	Subscribe(ctx context.Context, channel string) (RedisSubscription, error)
+}
+
+// RedisSubscription is a subscription to a Redis pub/sub channel
+type RedisSubscription interface {
+	// Messages returns a channel receiving published messages. It is closed when subscription ends
+	Messages() <-chan string
+	Close() error
+}
+
+// redisScript is a Lua script run by EVALSHA, falling back to EVAL when not loaded in server
+type redisScript struct {
+	src  string
+	hash string
+}
+
+func newRedisScript(src string) *redisScript {
+	hash := sha1.Sum([]byte(src))
+
+	return &redisScript{
+		src:  src,
+		hash: hex.EncodeToString(hash[:]),
+	}
+}
+
+func (s *redisScript) run(ctx context.Context, client RedisClient, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := client.EvalSha(ctx, s.hash, keys, args...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return client.Eval(ctx, s.src, keys, args...)
+	}
+
+	return result, err
+}
+
+// redisSubscriber is implemented by go-redis v6 clients supporting pub/sub
+type redisSubscriber interface {
+	Subscribe(channels ...string) *redis.PubSub
+}
+
+// cmdableClient adapts go-redis v6 clients to RedisClient
+type cmdableClient struct {
+	client redis.Cmdable
+}
+
+// Get returns key value
+func (c *cmdableClient) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := withContext(ctx, func() (err error) {
+		value, err = c.client.Get(key).Result()
+
+		return err
+	})
+	if err == redis.Nil {
+		return "", RedisNilError
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// Set sets key value
+func (c *cmdableClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return withContext(ctx, func() error {
+		return c.client.Set(key, value, ttl).Err()
+	})
+}
+
+// Incr increments key value
+func (c *cmdableClient) Incr(ctx context.Context, key string) (int64, error) {
+	var value int64
+	err := withContext(ctx, func() (err error) {
+		value, err = c.client.Incr(key).Result()
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// Del removes keys
+func (c *cmdableClient) Del(ctx context.Context, keys ...string) error {
+	return withContext(ctx, func() error {
+		return c.client.Del(keys...).Err()
+	})
+}
+
+// PExpire sets key TTL
+func (c *cmdableClient) PExpire(ctx context.Context, key string, ttl time.Duration) error {
+	return withContext(ctx, func() error {
+		return c.client.PExpire(key, ttl).Err()
+	})
+}
+
+// HIncrBy increments hash field value
+func (c *cmdableClient) HIncrBy(ctx context.Context, key, field string, increment int64) error {
+	return withContext(ctx, func() error {
+		return c.client.HIncrBy(key, field, increment).Err()
+	})
+}
+
+// HGetAll returns hash fields and values
+func (c *cmdableClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	var values map[string]string
+	err := withContext(ctx, func() (err error) {
+		values, err = c.client.HGetAll(key).Result()
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// HDel removes hash fields
+func (c *cmdableClient) HDel(ctx context.Context, key string, fields ...string) error {
+	return withContext(ctx, func() error {
+		return c.client.HDel(key, fields...).Err()
+	})
+}
+
+// Eval runs Lua script
+func (c *cmdableClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	var result interface{}
+	err := withContext(ctx, func() (err error) {
+		result, err = c.client.Eval(script, keys, args...).Result()
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// EvalSha runs Lua script loaded in server
+func (c *cmdableClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	var result interface{}
+	err := withContext(ctx, func() (err error) {
+		result, err = c.client.EvalSha(sha1, keys, args...).Result()
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Publish posts message on channel
+func (c *cmdableClient) Publish(ctx context.Context, channel string, message string) error {
+	return withContext(ctx, func() error {
+		return c.client.Publish(channel, message).Err()
+	})
+}
+
+// Subscribe subscribes to channel. Only clients implementing Subscribe method support it, like redis.Client
+func (c *cmdableClient) Subscribe(ctx context.Context, channel string) (RedisSubscription, error) {
+	subscriber, ok := c.client.(redisSubscriber)
+	if !ok {
+		return nil, errors.New("pub/sub not supported by client")
+	}
+
+	pubsub := subscriber.Subscribe(channel)
+	err := withContext(ctx, func() error {
+		_, err := pubsub.Receive()
+
+		return err
+	})
+	if err != nil {
+		_ = pubsub.Close()
+
+		return nil, err
+	}
+
+	subscription := &cmdableSubscription{
+		pubsub:   pubsub,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go subscription.receive()
+
+	return subscription, nil
+}
+
+// cmdableSubscription adapts go-redis v6 pub/sub to RedisSubscription
+type cmdableSubscription struct {
+	pubsub   *redis.PubSub
+	messages chan string
+	done     chan struct{}
+}
+
+// receive forwards message payloads until subscription is closed
+func (s *cmdableSubscription) receive() {
+	defer close(s.messages)
+
+	for message := range s.pubsub.Channel() {
+		select {
+		case s.messages <- message.Payload:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Messages returns a channel receiving published messages
+func (s *cmdableSubscription) Messages() <-chan string {
+	return s.messages
+}
+
+// Close ends subscription
+func (s *cmdableSubscription) Close() error {
+	close(s.done)
+
+	return s.pubsub.Close()
+}
+
+// withContext runs cmd until it finishes or ctx is done.
+// go-redis v6 does not use contexts on network calls, so cmd keeps running in background
+// after ctx is done, bounded by client timeouts.
+func withContext(ctx context.Context, cmd func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil {
+		return cmd()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- cmd()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package breaker
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RegistryOptions Registry settings.
+type RegistryOptions struct {
+	// Storage returns storage service of named circuit breaker. A MemoryStorage for each one by default
+	Storage func(name string) Storage
+	// Defaults options shared by circuit breakers. Name is replaced by circuit breaker name
+	Defaults Options
+	// Overrides modify a copy of Defaults for the circuit breaker with that name
+	Overrides map[string]func(options *Options)
+}
+
+// Registry creates circuit breakers by name and returns the same one later. It is safe for concurrent use
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+	options RegistryOptions
+}
+
+// registryEntry holds a circuit breaker and the error creating it, available once ready is closed
+type registryEntry struct {
+	ready   chan struct{}
+	breaker *Breaker
+	err     error
+}
+
+// NewRegistry implements Registry factory
+func NewRegistry(options *RegistryOptions) *Registry {
+	r := &Registry{
+		entries: map[string]*registryEntry{},
+	}
+
+	if options != nil {
+		r.options = *options
+	}
+
+	if r.options.Storage == nil {
+		r.options.Storage = func(_ string) Storage {
+			return NewMemoryStorage()
+		}
+	}
+
+	return r
+}
+
+// Get returns circuit breaker with name, creating it if needed.
+// Like New, a circuit breaker in closed state is returned along with the error if its state can not be loaded.
+// Failed creations are not kept, so later calls try again.
+// Storage is accessed without holding the registry lock, so only calls getting the same new name wait for it
+func (r *Registry) Get(name string) (*Breaker, error) {
+	entry, created := r.entry(name)
+	if created {
+		r.create(name, entry)
+	}
+	<-entry.ready
+
+	return entry.breaker, entry.err
+}
+
+// create sets circuit breaker of entry. If Storage or New fail or panic, entry is removed before waiters get its error
+func (r *Registry) create(name string, entry *registryEntry) {
+	entry.err = errors.Errorf("Registry -> Get: %q creation panicked", name)
+	defer r.ready(name, entry)
+
+	b, err := New(r.options.Storage(name), r.breakerOptions(name))
+	entry.breaker, entry.err = b, errors.Wrap(err, "Registry -> Get")
+}
+
+// ready removes entry of name if it has an error, then marks it ready
+func (r *Registry) ready(name string, entry *registryEntry) {
+	if entry.err != nil {
+		r.mu.Lock()
+		delete(r.entries, name)
+		r.mu.Unlock()
+	}
+
+	close(entry.ready)
+}
+
+// entry returns the entry of name, adding a new one if needed. Created is true when added
+func (r *Registry) entry(name string) (entry *registryEntry, created bool) {
+	r.mu.RLock()
+	entry, ok := r.entries[name]
+	r.mu.RUnlock()
+
+	if ok {
+		return entry, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok = r.entries[name]; ok {
+		return entry, false
+	}
+
+	entry = &registryEntry{ready: make(chan struct{})}
+	r.entries[name] = entry
+
+	return entry, true
+}
+
+// breakerOptions returns default options with overrides for name applied
+func (r *Registry) breakerOptions(name string) *Options {
+	options := r.options.Defaults
+	if override, ok := r.options.Overrides[name]; ok {
+		override(&options)
+	}
+	options.Name = name
+
+	return &options
+}
+
+// Breakers returns circuit breakers created by registry, sorted by name. Breakers still being created are skipped
+func (r *Registry) Breakers() []*Breaker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	breakers := make([]*Breaker, 0, len(r.entries))
+	for _, entry := range r.entries {
+		select {
+		case <-entry.ready:
+			breakers = append(breakers, entry.breaker)
+		default:
+		}
+	}
+
+	sort.Slice(breakers, func(i, j int) bool {
+		return breakers[i].Name() < breakers[j].Name()
+	})
+
+	return breakers
+}
+
+// States returns current state of each circuit breaker created by registry, by name
+func (r *Registry) States() map[string]State {
+	states := map[string]State{}
+	for _, b := range r.Breakers() {
+		states[b.Name()] = b.State()
+	}
+
+	return states
+}
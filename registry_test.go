@@ -0,0 +1,159 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Get(t *testing.T) {
+	storages := map[string]*breaker.MemoryStorage{}
+	registry := breaker.NewRegistry(&breaker.RegistryOptions{
+		Storage: func(name string) breaker.Storage {
+			storages[name] = breaker.NewMemoryStorage()
+
+			return storages[name]
+		},
+		Defaults: breaker.Options{MaxFailures: 1},
+		Overrides: map[string]func(options *breaker.Options){
+			"search": func(options *breaker.Options) {
+				options.MaxFailures = 2
+			},
+		},
+	})
+
+	payments, err := registry.Get("payments")
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", payments.Name())
+
+	same, err := registry.Get("payments")
+	assert.NoError(t, err)
+	assert.Same(t, payments, same)
+
+	search, err := registry.Get("search")
+	assert.NoError(t, err)
+
+	assert.NoError(t, payments.Fail())
+	assert.NoError(t, search.Fail())
+
+	err = payments.Ready()
+	assert.True(t, errors.Is(err, breaker.OpenCircuitError))
+	assert.Equal(t, "breaker: open circuit (payments)", err.Error())
+
+	assert.NoError(t, search.Ready())
+
+	failures, err := storages["search"].GetFailures(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+}
+
+func TestRegistry_States(t *testing.T) {
+	registry := breaker.NewRegistry(nil)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := registry.Get("payments")
+			assert.NoError(t, err)
+			_, err = registry.Get("auth")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	breakers := registry.Breakers()
+	assert.Len(t, breakers, 2)
+	assert.Equal(t, "auth", breakers[0].Name())
+	assert.Equal(t, "payments", breakers[1].Name())
+
+	states := registry.States()
+	assert.Len(t, states, 2)
+	assert.Equal(t, "closed", states["payments"].String())
+	assert.Equal(t, "closed", states["auth"].String())
+}
+
+func TestRegistry_SlowStorage(t *testing.T) {
+	release := make(chan struct{})
+	registry := breaker.NewRegistry(&breaker.RegistryOptions{
+		Storage: func(name string) breaker.Storage {
+			if name == "slow" {
+				<-release
+			}
+
+			return breaker.NewMemoryStorage()
+		},
+	})
+
+	payments, err := registry.Get("payments")
+	assert.NoError(t, err)
+
+	slow := make(chan *breaker.Breaker, 2)
+	for g := 0; g < 2; g++ {
+		go func() {
+			b, err := registry.Get("slow")
+			assert.NoError(t, err)
+			slow <- b
+		}()
+	}
+
+	// Other breakers are available while slow one is created
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		same, err := registry.Get("payments")
+		assert.NoError(t, err)
+		assert.Same(t, payments, same)
+		_, err = registry.Get("auth")
+		assert.NoError(t, err)
+		assert.Len(t, registry.Breakers(), 2)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("registry blocked by slow storage")
+	}
+
+	close(release)
+	assert.Same(t, <-slow, <-slow)
+	assert.Len(t, registry.Breakers(), 3)
+}
+
+func TestRegistry_FailedCreation(t *testing.T) {
+	calls := 0
+	registry := breaker.NewRegistry(&breaker.RegistryOptions{
+		Storage: func(name string) breaker.Storage {
+			calls++
+			switch {
+			case calls == 1:
+				panic("storage not available")
+			case calls == 2:
+				return baseStorage{breaker.NewMemoryStorage()}
+			}
+
+			return breaker.NewMemoryStorage()
+		},
+		Defaults: breaker.Options{WindowSize: time.Minute},
+	})
+
+	assert.Panics(t, func() { _, _ = registry.Get("payments") })
+	assert.Empty(t, registry.States())
+
+	b, err := registry.Get("payments")
+	assert.Nil(t, b)
+	assert.True(t, errors.Is(err, breaker.UnsupportedStorageError))
+	assert.Empty(t, registry.States())
+
+	b, err = registry.Get("payments")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]breaker.State{"payments": b.State()}, registry.States())
+}
@@ -0,0 +1,431 @@
+package breaker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSQLTable is the table name prefix used by SQLStorage when no table is given
+const DefaultSQLTable string = "breaker"
+
+// SQLDialect is the SQL flavor of the database used by SQLStorage
+type SQLDialect string
+
+const (
+	// DialectSQLite uses ? placeholders and ON CONFLICT upserts. Requires SQLite 3.24 or newer
+	DialectSQLite SQLDialect = "sqlite"
+	// DialectPostgres uses $n placeholders and ON CONFLICT upserts
+	DialectPostgres SQLDialect = "postgres"
+	// DialectMySQL uses ? placeholders and INSERT IGNORE upserts
+	DialectMySQL SQLDialect = "mysql"
+)
+
+// SQLOptions SQLStorage settings.
+type SQLOptions struct {
+	// Name of the circuit breaker row, so every instance using the same name shares the circuit. Required
+	Name string
+	// Table prefix of tables, like breaker_states and breaker_counts. DefaultSQLTable by default.
+	// It is not escaped, so it must not come from user input
+	Table string
+	// Dialect of the database. DialectSQLite by default
+	Dialect SQLDialect
+}
+
+// SQLStorage to save circuit breaker current status into a relational database through database/sql.
+// Tables are created by Migrate
+type SQLStorage struct {
+	db      *sql.DB
+	name    string
+	states  string
+	counts  string
+	dialect SQLDialect
+	// oldest time window bucket asked by GetCounts, older ones are removed when a bucket is added
+	oldest int64
+}
+
+// NewSQLStorage returns a SQLStorage object.
+// It fails with InvalidNameError if options or Name are empty, as a generated name is not shared by other instances
+func NewSQLStorage(db *sql.DB, options *SQLOptions) (*SQLStorage, error) {
+	if options == nil || options.Name == "" {
+		return nil, errors.Wrap(InvalidNameError, "NewSQLStorage -> empty name")
+	}
+
+	ss := SQLStorage{
+		db:      db,
+		name:    options.Name,
+		states:  DefaultSQLTable + "_states",
+		counts:  DefaultSQLTable + "_counts",
+		dialect: DialectSQLite,
+	}
+
+	if options.Table != "" {
+		ss.states = options.Table + "_states"
+		ss.counts = options.Table + "_counts"
+	}
+
+	if options.Dialect != "" {
+		ss.dialect = options.Dialect
+	}
+
+	return &ss, nil
+}
+
+// MustNewSQLStorage is like NewSQLStorage but panics if Name is empty.
+// It simplifies building storages from known names, like in RegistryOptions
+func MustNewSQLStorage(db *sql.DB, options *SQLOptions) *SQLStorage {
+	ss, err := NewSQLStorage(db, options)
+	if err != nil {
+		panic(err)
+	}
+
+	return ss
+}
+
+// Migrate creates storage tables if they do not exist. It is safe to run it on every start
+func (ss *SQLStorage) Migrate(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + ss.states + ` (
+			name VARCHAR(255) NOT NULL PRIMARY KEY,
+			state VARCHAR(16) NOT NULL DEFAULT 'closed',
+			open_until BIGINT NOT NULL DEFAULT 0,
+			failures INTEGER NOT NULL DEFAULT 0,
+			backoff_level INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + ss.counts + ` (
+			name VARCHAR(255) NOT NULL,
+			bucket BIGINT NOT NULL,
+			successes INTEGER NOT NULL DEFAULT 0,
+			failures INTEGER NOT NULL DEFAULT 0,
+			slow_calls INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (name, bucket)
+		)`,
+	}
+
+	for _, statement := range statements {
+		_, err := ss.db.ExecContext(ctx, statement)
+		if err != nil {
+			return errors.Wrap(err, "SQLStorage -> Migrate")
+		}
+	}
+
+	return nil
+}
+
+// GetCurrentState returns current circuit breaker state.
+// Open state without expiration time is considered expired
+func (ss *SQLStorage) GetCurrentState(ctx context.Context) (State, error) {
+	state, err := ss.getCurrentState(ctx)
+	if err != nil {
+		return state, errors.Wrap(err, "SQLStorage -> GetCurrentState")
+	}
+
+	return state, nil
+}
+
+func (ss *SQLStorage) getCurrentState(ctx context.Context) (State, error) {
+	var state string
+	var until int64
+	row := ss.db.QueryRowContext(ctx, ss.query("SELECT state, open_until FROM "+ss.states+" WHERE name = ?"), ss.name)
+	err := row.Scan(&state, &until)
+	if err == sql.ErrNoRows {
+		return NewClosed(), nil
+	}
+
+	if err != nil {
+		return NewClosed(), err
+	}
+
+	if until == 0 {
+		return parseState(state, "")
+	}
+
+	return parseState(state, strconv.FormatInt(until, 10))
+}
+
+// SetCurrentState persists the state, with expiration time for open state
+func (ss *SQLStorage) SetCurrentState(ctx context.Context, state State) error {
+	err := ss.update(ctx, ss.db, "UPDATE "+ss.states+" SET state = ?, open_until = ? WHERE name = ?",
+		state.String(), sqlOpenUntil(state), ss.name)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> SetCurrentState")
+	}
+
+	return nil
+}
+
+// TransitionState persists to state and clears failures in a single compare-and-swap update,
+// only if persisted state is still from
+func (ss *SQLStorage) TransitionState(ctx context.Context, from, to State) (State, error) {
+	swapped, err := ss.compareAndSwap(ctx, from, to)
+	if err != nil {
+		return from, errors.Wrap(err, "SQLStorage -> TransitionState")
+	}
+
+	if swapped {
+		return to, nil
+	}
+
+	state, err := ss.getCurrentState(ctx)
+	if err != nil {
+		return from, errors.Wrap(err, "SQLStorage -> TransitionState -> GetCurrentState")
+	}
+
+	return state, nil
+}
+
+// compareAndSwap replaces persisted state by to if it is still from, reporting if it did
+func (ss *SQLStorage) compareAndSwap(ctx context.Context, from, to State) (bool, error) {
+	err := ss.insert(ctx, ss.db)
+	if err != nil {
+		return false, err
+	}
+
+	// A persisted open state without expiration time matches any open state
+	result, err := ss.db.ExecContext(ctx, ss.query("UPDATE "+ss.states+" SET state = ?, open_until = ?, failures = 0 "+
+		"WHERE name = ? AND state = ? AND (state <> ? OR open_until = 0 OR open_until = ?)"),
+		to.String(), sqlOpenUntil(to), ss.name, from.String(), stateOpen, sqlOpenUntil(from))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+
+	return affected == 1, errors.Wrap(err, "RowsAffected")
+}
+
+// IncrementFailures increments failures count
+func (ss *SQLStorage) IncrementFailures(ctx context.Context) error {
+	err := ss.update(ctx, ss.db, "UPDATE "+ss.states+" SET failures = failures + 1 WHERE name = ?", ss.name)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> IncrementFailures")
+	}
+
+	return nil
+}
+
+// GetFailures gets failures count
+func (ss *SQLStorage) GetFailures(ctx context.Context) (int, error) {
+	var failures int
+	row := ss.db.QueryRowContext(ctx, ss.query("SELECT failures FROM "+ss.states+" WHERE name = ?"), ss.name)
+	err := row.Scan(&failures)
+	switch err {
+	case nil:
+		return failures, nil
+	case sql.ErrNoRows:
+		return defaultFailure, nil
+	default:
+		return defaultFailure, errors.Wrap(err, "SQLStorage -> GetFailures")
+	}
+}
+
+// Clear sets failures counts to zero
+func (ss *SQLStorage) Clear(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, ss.query("UPDATE "+ss.states+" SET failures = 0 WHERE name = ?"), ss.name)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> Clear")
+	}
+
+	return nil
+}
+
+// IncrementCounts adds counts to the time window bucket.
+// When the bucket is added, buckets older than the oldest one asked by GetCounts are removed
+func (ss *SQLStorage) IncrementCounts(ctx context.Context, bucket int64, counts Counts) error {
+	result, err := ss.db.ExecContext(ctx, ss.upsert(ss.counts, "name, bucket", "?, ?"), ss.name, bucket)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> IncrementCounts")
+	}
+
+	if added, _ := result.RowsAffected(); added > 0 {
+		err = ss.prune(ctx)
+	}
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> IncrementCounts -> Delete")
+	}
+
+	_, err = ss.db.ExecContext(ctx, ss.query("UPDATE "+ss.counts+
+		" SET successes = successes + ?, failures = failures + ?, slow_calls = slow_calls + ? WHERE name = ? AND bucket = ?"),
+		counts.Successes, counts.Failures, counts.SlowCalls, ss.name, bucket)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> IncrementCounts")
+	}
+
+	return nil
+}
+
+// prune removes buckets older than the oldest one asked by GetCounts
+func (ss *SQLStorage) prune(ctx context.Context) error {
+	oldest := atomic.LoadInt64(&ss.oldest)
+	if oldest == 0 {
+		return nil
+	}
+
+	_, err := ss.db.ExecContext(ctx, ss.query("DELETE FROM "+ss.counts+" WHERE name = ? AND bucket < ?"), ss.name, oldest)
+
+	return err
+}
+
+// GetCounts returns the sum of counts from oldest bucket on. Older buckets are removed by IncrementCounts,
+// so reading counts does not write
+func (ss *SQLStorage) GetCounts(ctx context.Context, oldest int64) (Counts, error) {
+	atomic.StoreInt64(&ss.oldest, oldest)
+
+	var counts Counts
+	row := ss.db.QueryRowContext(ctx, ss.query("SELECT COALESCE(SUM(successes), 0), COALESCE(SUM(failures), 0), "+
+		"COALESCE(SUM(slow_calls), 0) FROM "+ss.counts+" WHERE name = ? AND bucket >= ?"), ss.name, oldest)
+	err := row.Scan(&counts.Successes, &counts.Failures, &counts.SlowCalls)
+	if err != nil {
+		return Counts{}, errors.Wrap(err, "SQLStorage -> GetCounts")
+	}
+
+	return counts, nil
+}
+
+// ClearCounts discards all time window buckets
+func (ss *SQLStorage) ClearCounts(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, ss.query("DELETE FROM "+ss.counts+" WHERE name = ?"), ss.name)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> ClearCounts")
+	}
+
+	return nil
+}
+
+// IncrementBackoffLevel increments open state backoff level, returning the new one.
+// Row stays locked by the update until the new level is read
+func (ss *SQLStorage) IncrementBackoffLevel(ctx context.Context) (int, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLStorage -> IncrementBackoffLevel -> Begin")
+	}
+	defer func() {
+		// Rollback after commit does nothing
+		_ = tx.Rollback()
+	}()
+
+	err = ss.update(ctx, tx, "UPDATE "+ss.states+" SET backoff_level = backoff_level + 1 WHERE name = ?", ss.name)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLStorage -> IncrementBackoffLevel")
+	}
+
+	var level int
+	row := tx.QueryRowContext(ctx, ss.query("SELECT backoff_level FROM "+ss.states+" WHERE name = ?"), ss.name)
+	err = row.Scan(&level)
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLStorage -> IncrementBackoffLevel")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err, "SQLStorage -> IncrementBackoffLevel -> Commit")
+	}
+
+	return level, nil
+}
+
+// GetBackoffLevel returns open state backoff level
+func (ss *SQLStorage) GetBackoffLevel(ctx context.Context) (int, error) {
+	var level int
+	row := ss.db.QueryRowContext(ctx, ss.query("SELECT backoff_level FROM "+ss.states+" WHERE name = ?"), ss.name)
+	err := row.Scan(&level)
+	switch err {
+	case nil:
+		return level, nil
+	case sql.ErrNoRows:
+		return 0, nil
+	default:
+		return 0, errors.Wrap(err, "SQLStorage -> GetBackoffLevel")
+	}
+}
+
+// ClearBackoffLevel sets open state backoff level to zero
+func (ss *SQLStorage) ClearBackoffLevel(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, ss.query("UPDATE "+ss.states+" SET backoff_level = 0 WHERE name = ?"), ss.name)
+	if err != nil {
+		return errors.Wrap(err, "SQLStorage -> ClearBackoffLevel")
+	}
+
+	return nil
+}
+
+// querier runs queries on a database or a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// update runs query on circuit breaker row, inserting the row first when it does not exist
+func (ss *SQLStorage) update(ctx context.Context, q querier, query string, args ...interface{}) error {
+	result, err := q.ExecContext(ctx, ss.query(query), args...)
+	if err != nil {
+		return err
+	}
+
+	// MySQL does not count rows left unchanged, so the row may exist anyway. Insert is ignored then
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+
+	err = ss.insert(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, ss.query(query), args...)
+
+	return err
+}
+
+// insert adds circuit breaker row in closed state, unless it exists
+func (ss *SQLStorage) insert(ctx context.Context, q querier) error {
+	_, err := q.ExecContext(ctx, ss.upsert(ss.states, "name", "?"), ss.name)
+
+	return err
+}
+
+// upsert returns an insert statement ignoring rows already in table
+func (ss *SQLStorage) upsert(table, columns, values string) string {
+	if ss.dialect == DialectMySQL {
+		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s)", table, columns, values)
+	}
+
+	return ss.query(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO NOTHING", table, columns, values, columns))
+}
+
+// query replaces ? placeholders by $n ones for Postgres
+func (ss *SQLStorage) query(query string) string {
+	if ss.dialect != DialectPostgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			sb.WriteRune(r)
+
+			continue
+		}
+
+		n++
+		sb.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return sb.String()
+}
+
+// sqlOpenUntil returns expiration time of open state in unix nanoseconds. Zero if not open or not started
+func sqlOpenUntil(state State) int64 {
+	open, ok := state.(*Open)
+	if !ok || open.Until().IsZero() {
+		return 0
+	}
+
+	return open.Until().UnixNano()
+}
@@ -0,0 +1,309 @@
+package breaker_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/francisco-alejandro/breaker"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newTestSQL(t *testing.T) *sql.DB {
+	path := filepath.Join(t.TempDir(), "breaker.db")
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	assert.NoError(t, breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments"}).Migrate(context.Background()))
+
+	return db
+}
+
+func TestSQLStorage_Migrate(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQL(t)
+
+	ss := breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments", Table: "circuit"})
+	assert.NoError(t, ss.Migrate(ctx))
+	assert.NoError(t, ss.Migrate(ctx))
+
+	assert.NoError(t, ss.IncrementFailures(ctx))
+
+	var failures int
+	err := db.QueryRow("SELECT failures FROM circuit_states WHERE name = 'payments'").Scan(&failures)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	_, err = breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments", Table: "missing"}).GetCurrentState(ctx)
+	assert.Error(t, err, "SQLStorage -> GetCurrentState")
+}
+
+func TestNewSQLStorage(t *testing.T) {
+	db := newTestSQL(t)
+
+	_, err := breaker.NewSQLStorage(db, nil)
+	assert.EqualError(t, err, "NewSQLStorage -> empty name: breaker: invalid storage name")
+	_, err = breaker.NewSQLStorage(db, &breaker.SQLOptions{Table: "circuit"})
+	assert.True(t, errors.Is(err, breaker.InvalidNameError))
+
+	ss, err := breaker.NewSQLStorage(db, &breaker.SQLOptions{Name: "payments"})
+	assert.NoError(t, err)
+	assert.NoError(t, ss.Migrate(context.Background()))
+
+	assert.PanicsWithError(t, "NewSQLStorage -> empty name: breaker: invalid storage name", func() {
+		breaker.MustNewSQLStorage(db, nil)
+	})
+}
+
+func TestSQLStorage_State(t *testing.T) {
+	ctx := context.Background()
+	ss := breaker.MustNewSQLStorage(newTestSQL(t), &breaker.SQLOptions{Name: "payments"})
+
+	state, err := ss.GetCurrentState(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.NewClosed(), state)
+
+	until := time.Now().Add(time.Minute).Round(0)
+	assert.NoError(t, ss.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), until)))
+
+	state, err = ss.GetCurrentState(ctx)
+	assert.NoError(t, err)
+	open, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, until.Equal(open.Until()))
+
+	assert.NoError(t, ss.SetCurrentState(ctx, breaker.NewHalfOpen()))
+
+	state, err = ss.GetCurrentState(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.NewHalfOpen(), state)
+}
+
+func TestSQLStorage_Failures(t *testing.T) {
+	ctx := context.Background()
+	ss := breaker.MustNewSQLStorage(newTestSQL(t), &breaker.SQLOptions{Name: "payments"})
+
+	failures, err := ss.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	assert.NoError(t, ss.IncrementFailures(ctx))
+	assert.NoError(t, ss.IncrementFailures(ctx))
+
+	failures, err = ss.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	assert.NoError(t, ss.Clear(ctx))
+
+	failures, err = ss.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+}
+
+func TestSQLStorage_Counts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQL(t)
+	ss := breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments"})
+
+	assert.NoError(t, ss.IncrementCounts(ctx, 1, breaker.Counts{Successes: 1}))
+	assert.NoError(t, ss.IncrementCounts(ctx, 2, breaker.Counts{Failures: 1, SlowCalls: 1}))
+	assert.NoError(t, ss.IncrementCounts(ctx, 2, breaker.Counts{Successes: 2}))
+	assert.NoError(t, breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "orders"}).IncrementCounts(ctx, 2, breaker.Counts{Successes: 5}))
+
+	counts, err := ss.GetCounts(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 3, Failures: 1, SlowCalls: 1}, counts)
+
+	counts, err = ss.GetCounts(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 2, Failures: 1, SlowCalls: 1}, counts)
+
+	// Reading counts does not remove older buckets, adding a bucket does
+	var buckets int
+	err = db.QueryRow("SELECT COUNT(*) FROM breaker_counts WHERE name = 'payments'").Scan(&buckets)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, buckets)
+
+	assert.NoError(t, ss.IncrementCounts(ctx, 3, breaker.Counts{Successes: 1}))
+	err = db.QueryRow("SELECT COUNT(*) FROM breaker_counts WHERE name = 'payments'").Scan(&buckets)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, buckets)
+
+	err = db.QueryRow("SELECT COUNT(*) FROM breaker_counts WHERE name = 'orders'").Scan(&buckets)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, buckets)
+
+	assert.NoError(t, ss.ClearCounts(ctx))
+
+	counts, err = ss.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{}, counts)
+}
+
+func TestSQLStorage_BackoffLevel(t *testing.T) {
+	ctx := context.Background()
+	ss := breaker.MustNewSQLStorage(newTestSQL(t), &breaker.SQLOptions{Name: "payments"})
+
+	level, err := ss.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = ss.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, level)
+
+	assert.NoError(t, ss.ClearBackoffLevel(ctx))
+
+	level, err = ss.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = ss.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+}
+
+// recordingConnector opens connections recording executed statements, which report affected rows
+type recordingConnector struct {
+	affected   int64
+	statements []string
+}
+
+func (rc *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return rc, nil
+}
+
+func (rc *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (rc *recordingConnector) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (rc *recordingConnector) Close() error {
+	return nil
+}
+
+func (rc *recordingConnector) Begin() (driver.Tx, error) {
+	return nil, errors.New("begin not supported")
+}
+
+func (rc *recordingConnector) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	rc.statements = append(rc.statements, query)
+
+	return driver.RowsAffected(rc.affected), nil
+}
+
+func TestSQLStorage_Dialects(t *testing.T) {
+	ctx := context.Background()
+
+	postgres := &recordingConnector{affected: 1}
+	ss := breaker.MustNewSQLStorage(sql.OpenDB(postgres), &breaker.SQLOptions{Name: "payments", Dialect: breaker.DialectPostgres})
+	assert.NoError(t, ss.IncrementFailures(ctx))
+	assert.NoError(t, ss.IncrementCounts(ctx, 2, breaker.Counts{Successes: 1}))
+	assert.Equal(t, []string{
+		"UPDATE breaker_states SET failures = failures + 1 WHERE name = $1",
+		"INSERT INTO breaker_counts (name, bucket) VALUES ($1, $2) ON CONFLICT (name, bucket) DO NOTHING",
+		"UPDATE breaker_counts SET successes = successes + $1, failures = failures + $2, slow_calls = slow_calls + $3 " +
+			"WHERE name = $4 AND bucket = $5",
+	}, postgres.statements)
+
+	// MySQL does not count rows left unchanged, so the row is inserted if missing and updated again
+	mysql := &recordingConnector{affected: 0}
+	ss = breaker.MustNewSQLStorage(sql.OpenDB(mysql), &breaker.SQLOptions{Name: "payments", Dialect: breaker.DialectMySQL})
+	assert.NoError(t, ss.SetCurrentState(ctx, breaker.NewHalfOpen()))
+	assert.Equal(t, []string{
+		"UPDATE breaker_states SET state = ?, open_until = ? WHERE name = ?",
+		"INSERT IGNORE INTO breaker_states (name) VALUES (?)",
+		"UPDATE breaker_states SET state = ?, open_until = ? WHERE name = ?",
+	}, mysql.statements)
+}
+
+func TestSQLStorage_TransitionState(t *testing.T) {
+	ctx := context.Background()
+	ticker := clock.New()
+	until := time.Now().Add(time.Minute).Round(0)
+	ss := breaker.MustNewSQLStorage(newTestSQL(t), &breaker.SQLOptions{Name: "payments"})
+
+	assert.NoError(t, ss.IncrementFailures(ctx))
+
+	open := breaker.NewOpenUntil(ticker, until)
+	state, err := ss.TransitionState(ctx, breaker.NewClosed(), open)
+	assert.NoError(t, err)
+	assert.Equal(t, open, state)
+
+	failures, err := ss.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	state, err = ss.TransitionState(ctx, breaker.NewClosed(), breaker.NewOpenUntil(ticker, until.Add(time.Minute)))
+	assert.NoError(t, err)
+	persisted, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, until.Equal(persisted.Until()))
+
+	state, err = ss.TransitionState(ctx, breaker.NewOpenUntil(ticker, until.Add(-time.Minute)), breaker.NewHalfOpen())
+	assert.NoError(t, err)
+	_, ok = state.(*breaker.Open)
+	assert.True(t, ok)
+
+	halfOpen := breaker.NewHalfOpen()
+	state, err = ss.TransitionState(ctx, open, halfOpen)
+	assert.NoError(t, err)
+	assert.Equal(t, halfOpen, state)
+}
+
+func TestSQLStorage_AtomicTransition(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQL(t)
+	options := breaker.Options{
+		MaxFailures:       1,
+		OpenStateDuration: time.Minute,
+		OpenStateBackoff:  &breaker.ExponentialBackoff{},
+	}
+
+	// Each breaker plays an instance sharing the circuit
+	breakers := make([]*breaker.Breaker, 10)
+	for i := range breakers {
+		var err error
+		breakers[i], err = breaker.New(breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments"}), &options)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, breaker.MustNewSQLStorage(db, &breaker.SQLOptions{Name: "payments"}).IncrementFailures(ctx))
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, b := range breakers {
+		wg.Add(1)
+		go func(b *breaker.Breaker) {
+			defer wg.Done()
+			<-start
+
+			// Instances checking failures after the trip stay closed until they load the state
+			err := b.ReadyContext(ctx)
+			assert.True(t, err == nil || errors.Is(err, breaker.OpenCircuitError))
+		}(b)
+	}
+	close(start)
+	wg.Wait()
+
+	var state string
+	var level int
+	err := db.QueryRow("SELECT state, backoff_level FROM breaker_states WHERE name = 'payments'").Scan(&state, &level)
+	assert.NoError(t, err)
+	assert.Equal(t, "open", state)
+	assert.Equal(t, 1, level)
+}
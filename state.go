@@ -1,6 +1,7 @@
 package breaker
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -17,13 +18,33 @@ const (
 // State is the interface for circuit breaker state. Immplementation of this interface ensure a valid state
 type State interface {
 	Ready() bool
-	Next(sr Storage, maxFailures int) (State, error)
-	OnEntry(sr Storage, stateDuration time.Duration) error
-	OnSuccess(sr Storage) error
-	OnFail(sr Storage) error
+	Next(ctx context.Context, sr Storage, options *Options) (State, error)
+	OnEntry(ctx context.Context, sr Storage, options *Options) error
+	OnSuccess(ctx context.Context, sr Storage, options *Options) error
+	OnFail(ctx context.Context, sr Storage, options *Options) error
+	OnSlowCall(ctx context.Context, sr Storage, options *Options) error
 	String() string
 }
 
+// atomicEntry is implemented by states with entry side effects not done by AtomicStorage.TransitionState
+type atomicEntry interface {
+	onAtomicEntry(ctx context.Context, sr Storage, options *Options) error
+}
+
+// windowStorage returns sr as a WindowStorage if time window is enabled and supported
+func windowStorage(sr Storage, options *Options) (WindowStorage, bool) {
+	ws, ok := sr.(WindowStorage)
+
+	return ws, ok && options.windowEnabled()
+}
+
+// backoffStorage returns sr as a BackoffStorage if open state backoff is enabled and supported
+func backoffStorage(sr Storage, options *Options) (BackoffStorage, bool) {
+	bs, ok := sr.(BackoffStorage)
+
+	return bs, ok && options.OpenStateBackoff != nil
+}
+
 // Closed state
 type Closed struct{}
 
@@ -36,42 +57,91 @@ func NewClosed() *Closed {
 func (sc *Closed) Ready() bool { return true }
 
 // Next return next circuit breaker state checking failures.
-// When failures is bigger than maxFaiules, circuit breaker goes to Open state
-func (sc *Closed) Next(sr Storage, maxFailures int) (State, error) {
-	failures, err := sr.GetFailures()
+// When TripStrategy option decides so, circuit breaker goes to Open state.
+// By default, when failures reaches MaxFailures or failures rate in time window reaches FailureRateThreshold
+func (sc *Closed) Next(ctx context.Context, sr Storage, options *Options) (State, error) {
+	counts, err := sc.counts(ctx, sr, options)
 	if err != nil {
-		return sc, errors.Wrap(err, "stateClosed -> Next -> GetFailures")
+		return sc, err
 	}
 
-	if failures < maxFailures {
+	if !options.getTripStrategy().ShouldTrip(counts) {
 		return sc, nil
 	}
 
-	return NewOpen(clock.New()), nil
+	return NewOpen(options.getClock()), nil
 }
 
-// OnEntry clears failures using storage service
-func (sc *Closed) OnEntry(sr Storage, _ time.Duration) error {
-	err := sr.SetCurrentState(sc)
+// counts returns a snapshot of consecutive failures and counts in current time window if enabled
+func (sc *Closed) counts(ctx context.Context, sr Storage, options *Options) (Counts, error) {
+	failures, err := sr.GetFailures(ctx)
+	if err != nil {
+		return Counts{}, errors.Wrap(err, "stateClosed -> Next -> GetFailures")
+	}
+
+	ws, ok := windowStorage(sr, options)
+	if !ok {
+		return Counts{ConsecutiveFailures: failures}, nil
+	}
+
+	_, oldest := options.windowBuckets()
+	counts, err := ws.GetCounts(ctx, oldest)
+	counts.ConsecutiveFailures = failures
+
+	return counts, errors.Wrap(err, "stateClosed -> Next -> GetCounts")
+}
+
+// OnEntry clears failures, time window counts and open state backoff level using storage service
+func (sc *Closed) OnEntry(ctx context.Context, sr Storage, options *Options) error {
+	err := sr.SetCurrentState(ctx, sc)
 	if err != nil {
 		return errors.Wrap(err, "stateClosed -> OnEntry -> SetCurrentState")
 	}
-	err = sr.Clear()
+	err = sr.Clear(ctx)
 	if err != nil {
 		return errors.Wrap(err, "stateClosed -> OnEntry -> Clear")
 	}
 
+	return sc.onAtomicEntry(ctx, sr, options)
+}
+
+// onAtomicEntry clears time window counts and open state backoff level.
+// State and failures are already persisted by AtomicStorage.TransitionState
+func (sc *Closed) onAtomicEntry(ctx context.Context, sr Storage, options *Options) error {
+	if ws, ok := windowStorage(sr, options); ok {
+		err := ws.ClearCounts(ctx)
+		if err != nil {
+			return errors.Wrap(err, "stateClosed -> OnEntry -> ClearCounts")
+		}
+	}
+
+	if bs, ok := backoffStorage(sr, options); ok {
+		err := bs.ClearBackoffLevel(ctx)
+		if err != nil {
+			return errors.Wrap(err, "stateClosed -> OnEntry -> ClearBackoffLevel")
+		}
+	}
+
 	return nil
 }
 
 // OnSuccess clears failures using storage service when controlled logic by circuit breaker works propertly.
-func (sc *Closed) OnSuccess(sr Storage) error {
-	failures, _ := sr.GetFailures()
+// Success is counted in current time window if enabled
+func (sc *Closed) OnSuccess(ctx context.Context, sr Storage, options *Options) error {
+	if ws, ok := windowStorage(sr, options); ok {
+		current, _ := options.windowBuckets()
+		err := ws.IncrementCounts(ctx, current, Counts{Successes: 1})
+		if err != nil {
+			return errors.Wrap(err, "stateClosed -> OnSuccess -> IncrementCounts")
+		}
+	}
+
+	failures, _ := sr.GetFailures(ctx)
 	if failures == 0 {
 		return nil
 	}
 
-	err := sr.Clear()
+	err := sr.Clear(ctx)
 	if err != nil {
 		return errors.Wrap(err, "stateClosed -> OnSuccess -> Clear")
 	}
@@ -80,11 +150,35 @@ func (sc *Closed) OnSuccess(sr Storage) error {
 }
 
 // OnFail increments failures count using storage service when controlled logic by circuit breaker fails.
-func (sc *Closed) OnFail(sr Storage) error {
-	err := sr.IncrementFailures()
+// Failure is counted in current time window if enabled
+func (sc *Closed) OnFail(ctx context.Context, sr Storage, options *Options) error {
+	return sc.fail(ctx, sr, options, Counts{Failures: 1}, "stateClosed -> OnFail")
+}
+
+// OnSlowCall counts a failure when controlled logic by circuit breaker takes longer than SlowCallThreshold.
+// Slow call is counted in current time window too if enabled
+func (sc *Closed) OnSlowCall(ctx context.Context, sr Storage, options *Options) error {
+	return sc.fail(ctx, sr, options, Counts{Failures: 1, SlowCalls: 1}, "stateClosed -> OnSlowCall")
+}
+
+// fail increments failures count, adding counts to current time window if enabled.
+// Errors are wrapped with caller name
+func (sc *Closed) fail(ctx context.Context, sr Storage, options *Options, counts Counts, caller string) error {
+	err := sr.IncrementFailures(ctx)
 
 	if err != nil {
-		return errors.Wrap(err, "stateClosed -> OnFail -> IncrementFailures")
+		return errors.Wrap(err, caller+" -> IncrementFailures")
+	}
+
+	ws, ok := windowStorage(sr, options)
+	if !ok {
+		return nil
+	}
+
+	current, _ := options.windowBuckets()
+	err = ws.IncrementCounts(ctx, current, counts)
+	if err != nil {
+		return errors.Wrap(err, caller+" -> IncrementCounts")
 	}
 
 	return nil
@@ -96,9 +190,9 @@ func (sc *Closed) String() string {
 
 // Open state
 type Open struct {
-	expiredTime bool
-	mu          sync.RWMutex
-	clock       clock.Clock
+	until time.Time
+	mu    sync.RWMutex
+	clock clock.Clock
 }
 
 // NewOpen returns an open circuit breaker state
@@ -108,54 +202,132 @@ func NewOpen(clock clock.Clock) *Open {
 	}
 }
 
+// NewOpenUntil returns an open circuit breaker state which expires at until time.
+// Storage implementations use it to restore persisted open states
+func NewOpenUntil(clock clock.Clock, until time.Time) *Open {
+	return &Open{
+		clock: clock,
+		until: until,
+	}
+}
+
 // Ready during open state is always false. Managed logic can not be executed
 func (so *Open) Ready() bool { return false }
 
-// Next return next circuit breaker state checking time in open state.
-// When time in open state is bigger than max expiration time, circuit breaker goes to half open state
-func (so *Open) Next(_ Storage, _ int) (State, error) {
+// Until returns the time when open state expires. Zero time if open state has not started yet
+func (so *Open) Until() time.Time {
 	so.mu.RLock()
 	defer so.mu.RUnlock()
-	if so.expiredTime {
+
+	return so.until
+}
+
+// Next return next circuit breaker state checking time in open state.
+// When time in open state is bigger than max expiration time, circuit breaker goes to half open state
+func (so *Open) Next(_ context.Context, _ Storage, _ *Options) (State, error) {
+	until := so.Until()
+	if !until.IsZero() && !so.clock.Now().Before(until) {
 		return NewHalfOpen(), nil
 	}
 
 	return so, nil
 }
 
-// OnEntry starts time to check open state expiration time. Failures are clear too
-func (so *Open) OnEntry(sr Storage, stateDuration time.Duration) error {
-	_ = so.clock.AfterFunc(stateDuration, func() {
-		so.mu.Lock()
-		defer so.mu.Unlock()
-		so.expiredTime = true
-	})
+// OnEntry starts open state period, persisting its expiration time. Failures are clear too.
+// Open state period is OpenStateDuration, increased by OpenStateBackoff option on consecutive openings
+func (so *Open) OnEntry(ctx context.Context, sr Storage, options *Options) error {
+	backoffErr := so.start(ctx, sr, options)
 
-	err := sr.SetCurrentState(so)
+	err := sr.SetCurrentState(ctx, so)
 	if err != nil {
 		return errors.Wrap(err, "stateOpen -> OnEntry -> SetCurrentState")
 	}
 
-	err = sr.Clear()
+	err = sr.Clear(ctx)
 	if err != nil {
 		return errors.Wrap(err, "stateOpen -> OnEntry -> Clear")
 	}
 
-	return nil
+	return backoffErr
+}
+
+// start sets open state expiration time, unless already started.
+// When backoff level can not be incremented, OpenStateDuration is used
+func (so *Open) start(ctx context.Context, sr Storage, options *Options) error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	if !so.until.IsZero() {
+		return nil
+	}
+
+	bs, ok := backoffStorage(sr, options)
+	if !ok {
+		so.until = so.clock.Now().Add(openDuration(options, 0))
+
+		return nil
+	}
+
+	level, err := bs.IncrementBackoffLevel(ctx)
+	so.until = so.clock.Now().Add(openDuration(options, level-1))
+
+	return errors.Wrap(err, "stateOpen -> OnEntry -> IncrementBackoffLevel")
+}
+
+// starting returns an open state expiring after its period, to be persisted by AtomicStorage.TransitionState.
+// Period is computed from persisted backoff level, which is incremented on entry.
+// When backoff level can not be read, OpenStateDuration is used
+func (so *Open) starting(ctx context.Context, sr Storage, options *Options) *Open {
+	level := 0
+	if bs, ok := backoffStorage(sr, options); ok {
+		level, _ = bs.GetBackoffLevel(ctx)
+	}
+
+	return NewOpenUntil(so.clock, so.clock.Now().Add(openDuration(options, level)))
+}
+
+// onAtomicEntry increments open state backoff level.
+// State, expiration time and failures are already persisted by AtomicStorage.TransitionState
+func (so *Open) onAtomicEntry(ctx context.Context, sr Storage, options *Options) error {
+	bs, ok := backoffStorage(sr, options)
+	if !ok {
+		return nil
+	}
+
+	_, err := bs.IncrementBackoffLevel(ctx)
+
+	return errors.Wrap(err, "stateOpen -> OnEntry -> IncrementBackoffLevel")
+}
+
+// openDuration returns open state period for backoff level. Invalid levels get OpenStateDuration
+func openDuration(options *Options, level int) time.Duration {
+	if options.OpenStateBackoff == nil || level < 0 {
+		return options.OpenStateDuration
+	}
+
+	return options.OpenStateBackoff.Duration(options.OpenStateDuration, level)
 }
 
 // OnSuccess to implement State interface.
-func (so *Open) OnSuccess(_ Storage) error { return nil }
+func (so *Open) OnSuccess(_ context.Context, _ Storage, _ *Options) error { return nil }
 
 // OnFail to implement State interface.
-func (so *Open) OnFail(_ Storage) error { return nil }
+func (so *Open) OnFail(_ context.Context, _ Storage, _ *Options) error { return nil }
+
+// OnSlowCall to implement State interface.
+func (so *Open) OnSlowCall(_ context.Context, _ Storage, _ *Options) error { return nil }
 
 func (so *Open) String() string {
 	return stateOpen
 }
 
 // HalfOpen state
-type HalfOpen struct{}
+type HalfOpen struct {
+	mu sync.Mutex
+	// trials deadlines of running trial requests, oldest first
+	trials    []time.Time
+	successes int
+}
 
 // NewHalfOpen returns an half-open circuit breaker state
 func NewHalfOpen() *HalfOpen {
@@ -165,29 +337,35 @@ func NewHalfOpen() *HalfOpen {
 // Ready during half open state is always true. Managed logic can be executed to check its behaviour
 func (sho *HalfOpen) Ready() bool { return true }
 
-// Next returns next circuit breaker state checking failures.
-// If failures, circuit breaker goes to open state, else to closed state
-func (sho *HalfOpen) Next(sr Storage, _ int) (State, error) {
+// Next returns next circuit breaker state checking failures and successes.
+// If failures, circuit breaker goes to open state. After HalfOpenSuccesses consecutive successes, to closed state
+func (sho *HalfOpen) Next(ctx context.Context, sr Storage, options *Options) (State, error) {
 	closed := NewClosed()
-	failures, err := sr.GetFailures()
+	failures, err := sr.GetFailures(ctx)
 	if err != nil {
 		return closed, errors.Wrap(err, "stateHalfOpen -> Next -> GetFailures")
 	}
 
 	if failures > 0 {
-		return NewOpen(clock.New()), nil
+		return NewOpen(options.getClock()), nil
 	}
 
-	return closed, nil
+	sho.mu.Lock()
+	defer sho.mu.Unlock()
+	if sho.successes >= options.HalfOpenSuccesses {
+		return closed, nil
+	}
+
+	return sho, nil
 }
 
 // OnEntry clears failures using storage service
-func (sho *HalfOpen) OnEntry(sr Storage, _ time.Duration) error {
-	err := sr.SetCurrentState(sho)
+func (sho *HalfOpen) OnEntry(ctx context.Context, sr Storage, _ *Options) error {
+	err := sr.SetCurrentState(ctx, sho)
 	if err != nil {
 		return errors.Wrap(err, "stateHalfOpen -> OnEntry -> SetCurrentState")
 	}
-	err = sr.Clear()
+	err = sr.Clear(ctx)
 	if err != nil {
 		return errors.Wrap(err, "stateHalfOpen -> OnEntry -> Clear")
 	}
@@ -195,12 +373,27 @@ func (sho *HalfOpen) OnEntry(sr Storage, _ time.Duration) error {
 	return nil
 }
 
-// OnSuccess to implement State interface.
-func (sho *HalfOpen) OnSuccess(_ Storage) error { return nil }
+// onAtomicEntry does nothing, as state and failures are already persisted by AtomicStorage.TransitionState
+func (sho *HalfOpen) onAtomicEntry(_ context.Context, _ Storage, _ *Options) error { return nil }
+
+// OnSuccess counts consecutive successes of trial requests.
+func (sho *HalfOpen) OnSuccess(_ context.Context, _ Storage, _ *Options) error {
+	sho.mu.Lock()
+	defer sho.mu.Unlock()
+
+	sho.successes++
+	sho.release()
+
+	return nil
+}
 
 // OnFail increments failures count using storage service when controlled logic by circuit breaker fails.
-func (sho *HalfOpen) OnFail(sr Storage) error {
-	err := sr.IncrementFailures()
+func (sho *HalfOpen) OnFail(ctx context.Context, sr Storage, _ *Options) error {
+	sho.mu.Lock()
+	sho.release()
+	sho.mu.Unlock()
+
+	err := sr.IncrementFailures(ctx)
 
 	if err != nil {
 		return errors.Wrap(err, "stateHalfOpen -> OnFail -> IncrementFailures")
@@ -209,6 +402,44 @@ func (sho *HalfOpen) OnFail(sr Storage) error {
 	return nil
 }
 
+// OnSlowCall counts slow trial requests as failures.
+func (sho *HalfOpen) OnSlowCall(ctx context.Context, sr Storage, options *Options) error {
+	return sho.OnFail(ctx, sr, options)
+}
+
 func (sho *HalfOpen) String() string {
 	return stateHalfOpen
 }
+
+// acquire admits a trial request unless HalfOpenMaxRequests are already running.
+// Trial requests not reported within OpenStateDuration expire, so a lost report does not keep half open state
+// rejecting requests. Trial requests are counted per process
+func (sho *HalfOpen) acquire(options *Options) bool {
+	now := options.getClock().Now()
+
+	sho.mu.Lock()
+	defer sho.mu.Unlock()
+
+	sho.expire(now)
+	if len(sho.trials) >= options.HalfOpenMaxRequests {
+		return false
+	}
+
+	sho.trials = append(sho.trials, now.Add(options.OpenStateDuration))
+
+	return true
+}
+
+// expire discards trial requests not reported before their deadline. Caller must hold sho.mu
+func (sho *HalfOpen) expire(now time.Time) {
+	for len(sho.trials) > 0 && !now.Before(sho.trials[0]) {
+		sho.trials = sho.trials[1:]
+	}
+}
+
+// release ends the oldest trial request. Caller must hold sho.mu
+func (sho *HalfOpen) release() {
+	if len(sho.trials) > 0 {
+		sho.trials = sho.trials[1:]
+	}
+}
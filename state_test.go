@@ -1,6 +1,7 @@
 package breaker_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -30,11 +31,11 @@ func newStorageMock(options storageMockOptions) *storageMock {
 	}
 }
 
-func (sm *storageMock) GetCurrentState() (breaker.State, error) {
+func (sm *storageMock) GetCurrentState(_ context.Context) (breaker.State, error) {
 	return breaker.NewClosed(), errors.New("server not available")
 }
 
-func (sm *storageMock) SetCurrentState(_ breaker.State) error {
+func (sm *storageMock) SetCurrentState(_ context.Context, _ breaker.State) error {
 	if sm.failSetCurrentState {
 		return errors.New("server not available")
 	}
@@ -42,18 +43,38 @@ func (sm *storageMock) SetCurrentState(_ breaker.State) error {
 	return nil
 }
 
-func (sm *storageMock) IncrementFailures() error {
+func (sm *storageMock) IncrementFailures(_ context.Context) error {
 	return errors.New("server not available")
 }
 
-func (sm *storageMock) GetFailures() (int, error) {
+func (sm *storageMock) GetFailures(_ context.Context) (int, error) {
 	if sm.failGetFailures {
 		return 0, errors.New("server not available")
 	}
 	return sm.failureCount, nil
 }
 
-func (sm *storageMock) Clear() error {
+func (sm *storageMock) Clear(_ context.Context) error {
+	return errors.New("server not available")
+}
+
+func (sm *storageMock) IncrementCounts(_ context.Context, _ int64, _ breaker.Counts) error {
+	return errors.New("server not available")
+}
+
+func (sm *storageMock) GetCounts(_ context.Context, _ int64) (breaker.Counts, error) {
+	return breaker.Counts{}, errors.New("server not available")
+}
+
+func (sm *storageMock) ClearCounts(_ context.Context) error {
+	return errors.New("server not available")
+}
+
+func (sm *storageMock) IncrementBackoffLevel(_ context.Context) (int, error) {
+	return 0, errors.New("server not available")
+}
+
+func (sm *storageMock) ClearBackoffLevel(_ context.Context) error {
 	return errors.New("server not available")
 }
 
@@ -65,50 +86,168 @@ func TestClosed_Ready(t *testing.T) {
 }
 
 func TestClosed_Next(t *testing.T) {
+	ctx := context.Background()
 	closed := breaker.NewClosed()
 	storage := breaker.NewMemoryStorage()
 	storageMock := newStorageMock(storageMockOptions{
 		failSetCurrentState: true,
 		failGetFailures:     true,
 	})
-	maxFailures := 1
+	options := &breaker.Options{MaxFailures: 1}
 
-	state, err := closed.Next(storage, maxFailures)
+	state, err := closed.Next(ctx, storage, options)
 	assert.NoError(t, err)
 	_, ok := state.(*breaker.Closed)
 	assert.True(t, ok)
 
-	err = storage.IncrementFailures()
+	err = storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	state, err = closed.Next(storage, maxFailures)
+	state, err = closed.Next(ctx, storage, options)
 	assert.NoError(t, err)
 
 	_, ok = state.(*breaker.Open)
 	assert.True(t, ok)
 
-	state, err = closed.Next(storageMock, maxFailures)
+	state, err = closed.Next(ctx, storageMock, options)
 	assert.Error(t, err, "stateClosed -> Next -> GetFailures")
 	_, ok = state.(*breaker.Closed)
 	assert.True(t, ok)
 
 }
 
+func TestClosed_NextWindow(t *testing.T) {
+	ctx := context.Background()
+	clockMock := clock.NewMock()
+	closed := breaker.NewClosed()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{
+		MaxFailures:   2,
+		WindowSize:    time.Minute,
+		WindowBuckets: 6,
+		Clock:         clockMock,
+	}
+
+	err := closed.OnFail(ctx, storage, options)
+	assert.NoError(t, err)
+
+	err = closed.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+
+	clockMock.Add(time.Second * 30)
+
+	err = closed.OnFail(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err := closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+
+	clockMock.Add(time.Second * 30)
+
+	state, err = closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, closed, state)
+
+	storageMock := newStorageMock(storageMockOptions{})
+	state, err = closed.Next(ctx, storageMock, options)
+	assert.Error(t, err, "stateClosed -> Next -> GetCounts")
+	assert.Equal(t, closed, state)
+}
+
+func TestClosed_NextFailureRate(t *testing.T) {
+	ctx := context.Background()
+	closed := breaker.NewClosed()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{
+		MaxFailures:          10,
+		WindowSize:           time.Minute,
+		FailureRateThreshold: 0.5,
+		MinimumRequests:      4,
+		Clock:                clock.NewMock(),
+	}
+
+	for i := 0; i < 3; i++ {
+		err := closed.OnFail(ctx, storage, options)
+		assert.NoError(t, err)
+	}
+
+	state, err := closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, closed, state)
+
+	for i := 0; i < 3; i++ {
+		err = closed.OnSuccess(ctx, storage, options)
+		assert.NoError(t, err)
+	}
+
+	state, err = closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+
+	err = closed.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err = closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, closed, state)
+}
+
+func TestClosed_NextTripStrategy(t *testing.T) {
+	ctx := context.Background()
+	closed := breaker.NewClosed()
+	storage := breaker.NewMemoryStorage()
+
+	var snapshot breaker.Counts
+	options := &breaker.Options{
+		WindowSize: time.Minute,
+		Clock:      clock.NewMock(),
+		TripStrategy: breaker.TripStrategyFunc(func(counts breaker.Counts) bool {
+			snapshot = counts
+
+			return counts.Successes > 0 && counts.ConsecutiveFailures > 1
+		}),
+	}
+
+	err := closed.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+
+	err = closed.OnFail(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err := closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, closed, state)
+	assert.Equal(t, breaker.Counts{Successes: 1, Failures: 1, ConsecutiveFailures: 1}, snapshot)
+
+	err = closed.OnFail(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err = closed.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+}
+
 func TestClosed_OnEntry(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{OpenStateDuration: time.Second}
 	closed := breaker.NewClosed()
 	storage := breaker.NewMemoryStorage()
 
-	err := storage.IncrementFailures()
+	err := storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	err = closed.OnEntry(storage, time.Second)
+	err = closed.OnEntry(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
-	state, err := storage.GetCurrentState()
+	state, err := storage.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := state.(*breaker.Closed)
@@ -117,17 +256,19 @@ func TestClosed_OnEntry(t *testing.T) {
 	storageMock := newStorageMock(storageMockOptions{
 		failSetCurrentState: true,
 	})
-	err = closed.OnEntry(storageMock, time.Second)
+	err = closed.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateClosed -> OnEntry -> SetCurrentState")
 
 	storageMock = newStorageMock(storageMockOptions{
 		failGetFailures: true,
 	})
-	err = closed.OnEntry(storageMock, time.Second)
+	err = closed.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateClosed -> OnEntry -> Clear")
 }
 
 func TestClosed_OnSuccess(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	closed := breaker.NewClosed()
 	storage := breaker.NewMemoryStorage()
 	storageMock := newStorageMock(storageMockOptions{
@@ -135,43 +276,70 @@ func TestClosed_OnSuccess(t *testing.T) {
 		failureCount:        1,
 	})
 
-	err := closed.OnSuccess(storage)
+	err := closed.OnSuccess(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
-	err = storage.IncrementFailures()
+	err = storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	err = closed.OnSuccess(storageMock)
+	err = closed.OnSuccess(ctx, storageMock, options)
 	assert.Error(t, err, "stateClosed -> OnSuccess -> Clear")
 
-	err = closed.OnSuccess(storage)
+	err = closed.OnSuccess(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err = storage.GetFailures()
+	failures, err = storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 }
 
 func TestClosed_OnFail(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	closed := breaker.NewClosed()
 	storage := breaker.NewMemoryStorage()
 
-	err := closed.OnFail(storage)
+	err := closed.OnFail(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, failures)
 
 	storageMock := newStorageMock(storageMockOptions{})
-	err = closed.OnFail(storageMock)
+	err = closed.OnFail(ctx, storageMock, options)
 	assert.Error(t, err, "stateClosed -> OnFail -> IncrementFailures")
 }
 
+func TestClosed_OnSlowCall(t *testing.T) {
+	ctx := context.Background()
+	closed := breaker.NewClosed()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{
+		WindowSize: time.Minute,
+		Clock:      clock.NewMock(),
+	}
+
+	err := closed.OnSlowCall(ctx, storage, options)
+	assert.NoError(t, err)
+
+	failures, err := storage.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	counts, err := storage.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Failures: 1, SlowCalls: 1}, counts)
+
+	storageMock := newStorageMock(storageMockOptions{})
+	err = closed.OnSlowCall(ctx, storageMock, options)
+	assert.Error(t, err, "stateClosed -> OnSlowCall -> IncrementFailures")
+}
+
 func TestOpen_Ready(t *testing.T) {
 	clockMock := clock.NewMock()
 	open := breaker.NewOpen(clockMock)
@@ -181,45 +349,107 @@ func TestOpen_Ready(t *testing.T) {
 }
 
 func TestOpen_Next(t *testing.T) {
+	ctx := context.Background()
 	clockMock := clock.NewMock()
 	storage := breaker.NewMemoryStorage()
-	maxFailures := 1
+	options := &breaker.Options{MaxFailures: 1, OpenStateDuration: time.Second}
 
 	open := breaker.NewOpen(clockMock)
 
-	state, err := open.Next(storage, maxFailures)
+	state, err := open.Next(ctx, storage, options)
 	assert.NoError(t, err)
 	_, ok := state.(*breaker.Open)
 	assert.True(t, ok)
 
-	err = open.OnEntry(storage, time.Second)
+	err = open.OnEntry(ctx, storage, options)
 	assert.NoError(t, err)
 
 	clockMock.Add(time.Second)
 
-	state, err = open.Next(storage, maxFailures)
+	state, err = open.Next(ctx, storage, options)
 	assert.NoError(t, err)
 	_, ok = state.(*breaker.HalfOpen)
 	assert.True(t, ok)
 }
 
+func TestOpen_Until(t *testing.T) {
+	ctx := context.Background()
+	clockMock := clock.NewMock()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{MaxFailures: 1, OpenStateDuration: time.Second}
+
+	open := breaker.NewOpen(clockMock)
+	assert.True(t, open.Until().IsZero())
+
+	err := open.OnEntry(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, clockMock.Now().Add(time.Second), open.Until())
+
+	clockMock.Add(time.Millisecond * 500)
+
+	err = open.OnEntry(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, clockMock.Now().Add(time.Millisecond*500), open.Until())
+
+	open = breaker.NewOpenUntil(clockMock, clockMock.Now())
+
+	state, err := open.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.HalfOpen)
+	assert.True(t, ok)
+}
+
+func TestOpen_OnEntryBackoff(t *testing.T) {
+	ctx := context.Background()
+	clockMock := clock.NewMock()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{
+		OpenStateDuration: time.Second,
+		OpenStateBackoff:  &breaker.ExponentialBackoff{},
+	}
+
+	for _, duration := range []time.Duration{time.Second, time.Second * 2, time.Second * 4} {
+		open := breaker.NewOpen(clockMock)
+
+		err := open.OnEntry(ctx, storage, options)
+		assert.NoError(t, err)
+		assert.Equal(t, clockMock.Now().Add(duration), open.Until())
+	}
+
+	err := breaker.NewClosed().OnEntry(ctx, storage, options)
+	assert.NoError(t, err)
+
+	open := breaker.NewOpen(clockMock)
+	err = open.OnEntry(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, clockMock.Now().Add(time.Second), open.Until())
+
+	storageMock := newStorageMock(storageMockOptions{})
+	open = breaker.NewOpen(clockMock)
+	err = open.OnEntry(ctx, storageMock, options)
+	assert.Error(t, err, "stateOpen -> OnEntry -> Clear")
+	assert.Equal(t, clockMock.Now().Add(time.Second), open.Until())
+}
+
 func TestOpen_OnEntry(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{OpenStateDuration: time.Second}
 	clockMock := clock.NewMock()
 	storage := breaker.NewMemoryStorage()
 
 	open := breaker.NewOpen(clockMock)
 
-	err := storage.IncrementFailures()
+	err := storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	err = open.OnEntry(storage, time.Second)
+	err = open.OnEntry(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
-	state, err := storage.GetCurrentState()
+	state, err := storage.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := state.(*breaker.Open)
@@ -228,31 +458,35 @@ func TestOpen_OnEntry(t *testing.T) {
 	storageMock := newStorageMock(storageMockOptions{
 		failSetCurrentState: true,
 	})
-	err = open.OnEntry(storageMock, time.Second)
+	err = open.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateOpen -> OnEntry -> SetCurrentState")
 
 	storageMock = newStorageMock(storageMockOptions{})
-	err = open.OnEntry(storageMock, time.Second)
+	err = open.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateOpen -> OnEntry -> Clear")
 }
 
 func TestOpen_OnFail(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	storage := breaker.NewMemoryStorage()
 	clockMock := clock.NewMock()
 
 	open := breaker.NewOpen(clockMock)
 
-	err := open.OnFail(storage)
+	err := open.OnFail(ctx, storage, options)
 	assert.NoError(t, err)
 }
 
 func TestOpen_OnSuccess(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	storage := breaker.NewMemoryStorage()
 	clockMock := clock.NewMock()
 
 	open := breaker.NewOpen(clockMock)
 
-	err := open.OnSuccess(storage)
+	err := open.OnSuccess(ctx, storage, options)
 	assert.NoError(t, err)
 }
 
@@ -264,19 +498,20 @@ func TestHalfOpen_Ready(t *testing.T) {
 }
 
 func TestHalfOpen_Next(t *testing.T) {
+	ctx := context.Background()
 	halfOpen := breaker.NewHalfOpen()
 	storage := breaker.NewMemoryStorage()
-	maxFailures := 0
+	options := &breaker.Options{}
 
-	state, err := halfOpen.Next(storage, maxFailures)
+	state, err := halfOpen.Next(ctx, storage, options)
 	assert.NoError(t, err)
 	_, ok := state.(*breaker.Closed)
 	assert.True(t, ok)
 
-	err = storage.IncrementFailures()
+	err = storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	state, err = halfOpen.Next(storage, maxFailures)
+	state, err = halfOpen.Next(ctx, storage, options)
 	assert.NoError(t, err)
 	_, ok = state.(*breaker.Open)
 	assert.True(t, ok)
@@ -284,27 +519,55 @@ func TestHalfOpen_Next(t *testing.T) {
 	storageMock := newStorageMock(storageMockOptions{
 		failGetFailures: true,
 	})
-	state, err = halfOpen.Next(storageMock, maxFailures)
+	state, err = halfOpen.Next(ctx, storageMock, options)
 	assert.Error(t, err, "stateHalfOpen -> Next -> GetFailures")
 	_, ok = state.(*breaker.Closed)
 	assert.True(t, ok)
 }
 
+func TestHalfOpen_NextSuccesses(t *testing.T) {
+	ctx := context.Background()
+	halfOpen := breaker.NewHalfOpen()
+	storage := breaker.NewMemoryStorage()
+	options := &breaker.Options{HalfOpenSuccesses: 2}
+
+	state, err := halfOpen.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, halfOpen, state)
+
+	err = halfOpen.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err = halfOpen.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	assert.Equal(t, halfOpen, state)
+
+	err = halfOpen.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+
+	state, err = halfOpen.Next(ctx, storage, options)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Closed)
+	assert.True(t, ok)
+}
+
 func TestHalfOpen_OnEntry(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{OpenStateDuration: time.Second}
 	halfOpen := breaker.NewHalfOpen()
 	storage := breaker.NewMemoryStorage()
 
-	err := storage.IncrementFailures()
+	err := storage.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	err = halfOpen.OnEntry(storage, time.Second)
+	err = halfOpen.OnEntry(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
-	state, err := storage.GetCurrentState()
+	state, err := storage.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := state.(*breaker.HalfOpen)
@@ -313,34 +576,55 @@ func TestHalfOpen_OnEntry(t *testing.T) {
 	storageMock := newStorageMock(storageMockOptions{
 		failSetCurrentState: true,
 	})
-	err = halfOpen.OnEntry(storageMock, time.Second)
+	err = halfOpen.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateHalfOpen -> OnEntry -> SetCurrentState")
 
 	storageMock = newStorageMock(storageMockOptions{})
-	err = halfOpen.OnEntry(storageMock, time.Second)
+	err = halfOpen.OnEntry(ctx, storageMock, options)
 	assert.Error(t, err, "stateHalfOpen -> OnEntry -> Clear")
 }
 
 func TestHalfOpen_OnSuccess(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
+	halfOpen := breaker.NewHalfOpen()
+	storage := breaker.NewMemoryStorage()
+
+	err := halfOpen.OnSuccess(ctx, storage, options)
+	assert.NoError(t, err)
+}
+
+func TestHalfOpen_OnSlowCall(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	halfOpen := breaker.NewHalfOpen()
 	storage := breaker.NewMemoryStorage()
 
-	err := halfOpen.OnSuccess(storage)
+	err := halfOpen.OnSlowCall(ctx, storage, options)
+	assert.NoError(t, err)
+
+	failures, err := storage.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	err = breaker.NewOpen(clock.NewMock()).OnSlowCall(ctx, storage, options)
 	assert.NoError(t, err)
 }
 
 func TestHalfOpen_OnFail(t *testing.T) {
+	ctx := context.Background()
+	options := &breaker.Options{}
 	halfOpen := breaker.NewHalfOpen()
 	storage := breaker.NewMemoryStorage()
 
-	err := halfOpen.OnFail(storage)
+	err := halfOpen.OnFail(ctx, storage, options)
 	assert.NoError(t, err)
 
-	failures, err := storage.GetFailures()
+	failures, err := storage.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, failures)
 
 	storageMock := newStorageMock(storageMockOptions{})
-	err = halfOpen.OnFail(storageMock)
+	err = halfOpen.OnFail(ctx, storageMock, options)
 	assert.Error(t, err, "stateHalfOpen -> OnFail -> IncrementFailures")
 }
@@ -1,9 +1,13 @@
 package breaker
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/go-redis/redis"
@@ -14,44 +18,266 @@ import (
 const (
 	failureKey     string = "FAILURES"
 	stateKey       string = "STATE"
+	openUntilKey   string = "OPEN_UNTIL"
+	windowKey      string = "WINDOW"
+	backoffKey     string = "BACKOFF_LEVEL"
+	transitionsKey string = "TRANSITIONS"
+	successesField string = "SUCCESSES"
+	failuresField  string = "FAILURES"
+	slowCallsField string = "SLOW_CALLS"
 	defaultFailure int    = 0
 )
 
+// DefaultRedisPrefix is the key prefix used by NewNamedRedisStorage when no prefix is given
+const DefaultRedisPrefix string = "breaker"
+
+// Counts holds the amount of successes and failures
+type Counts struct {
+	// Successes in time window
+	Successes int
+	// Failures in time window, slow calls included
+	Failures int
+	// SlowCalls in time window
+	SlowCalls int
+	// ConsecutiveFailures since last success. Only set on snapshots passed to TripStrategy
+	ConsecutiveFailures int
+}
+
+// Requests returns the amount of requests in time window
+func (c Counts) Requests() int {
+	return c.Successes + c.Failures
+}
+
+// add returns the sum of both counts
+func (c Counts) add(other Counts) Counts {
+	return Counts{
+		Successes: c.Successes + other.Successes,
+		Failures:  c.Failures + other.Failures,
+		SlowCalls: c.SlowCalls + other.SlowCalls,
+	}
+}
+
 // Storage is the interface for circuit breaker state storage.
+// Implementations should give up as soon as the context is done.
 type Storage interface {
-	GetCurrentState() (State, error)
-	SetCurrentState(state State) error
-	IncrementFailures() error
-	GetFailures() (int, error)
-	Clear() error
+	GetCurrentState(ctx context.Context) (State, error)
+	SetCurrentState(ctx context.Context, state State) error
+	IncrementFailures(ctx context.Context) error
+	GetFailures(ctx context.Context) (int, error)
+	Clear(ctx context.Context) error
+}
+
+// WindowStorage is implemented by storages able to count requests in a time window.
+// Breaker requires it when WindowSize is set
+type WindowStorage interface {
+	Storage
+	// IncrementCounts adds counts to the time window bucket
+	IncrementCounts(ctx context.Context, bucket int64, counts Counts) error
+	// GetCounts returns the sum of counts from oldest bucket on. Older buckets can be discarded
+	GetCounts(ctx context.Context, oldest int64) (Counts, error)
+	// ClearCounts discards all time window buckets
+	ClearCounts(ctx context.Context) error
+}
+
+// BackoffStorage is implemented by storages able to persist open state backoff level.
+// Breaker requires it when OpenStateBackoff is set
+type BackoffStorage interface {
+	Storage
+	// IncrementBackoffLevel increments open state backoff level, returning the new one
+	IncrementBackoffLevel(ctx context.Context) (int, error)
+	// GetBackoffLevel returns open state backoff level
+	GetBackoffLevel(ctx context.Context) (int, error)
+	// ClearBackoffLevel sets open state backoff level to zero
+	ClearBackoffLevel(ctx context.Context) error
+}
+
+// AtomicStorage is implemented by storages able to move circuit breaker state atomically.
+// When available, Breaker uses it so only one of the instances sharing the storage makes each transition
+type AtomicStorage interface {
+	Storage
+	// TransitionState persists to state and clears failures, only if persisted state is still from.
+	// For open states, expiration time must match too. Returns persisted state after the call,
+	// which is not to when another instance moved circuit breaker before
+	TransitionState(ctx context.Context, from, to State) (State, error)
+}
+
+// transitionScript compares persisted state and open state expiration time with expected ones.
+// When they match, state is replaced, failures cleared and new state returned. Else persisted state is returned.
+// Open state expiration time key expires with open state, and the others after idle TTL if set.
+// New state is published on transitions channel
+var transitionScript = newRedisScript(`
+local state = redis.call('GET', KEYS[1]) or 'closed'
+local openUntil = redis.call('GET', KEYS[2]) or ''
+if state ~= ARGV[1] or (state == 'open' and openUntil ~= '' and openUntil ~= ARGV[2]) then
+	return {state, openUntil}
+end
+redis.call('SET', KEYS[1], ARGV[3])
+if ARGV[4] ~= '' then
+	redis.call('SET', KEYS[2], ARGV[4])
+	redis.call('PEXPIREAT', KEYS[2], ARGV[5])
+end
+redis.call('SET', KEYS[3], '0')
+if tonumber(ARGV[6]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[6])
+end
+if tonumber(ARGV[7]) > 0 then
+	redis.call('PEXPIRE', KEYS[3], ARGV[7])
+end
+redis.call('PUBLISH', ARGV[8], ARGV[3])
+return {ARGV[3], ARGV[4]}
+`)
+
+// openScript saves open state and its expiration time, which expires with open state.
+// State and backoff level keys expire after TTL if set
+var openScript = newRedisScript(`
+redis.call('SET', KEYS[1], ARGV[1])
+redis.call('SET', KEYS[2], ARGV[2])
+redis.call('PEXPIREAT', KEYS[2], ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[3], ARGV[4])
+end
+return 1
+`)
+
+// backoffScript increments backoff level. Its key expires after idle TTL if set,
+// extended to keep it while the state key lives, as state key lasts until open state period ends
+var backoffScript = newRedisScript(`
+local level = redis.call('INCR', KEYS[1])
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.max(tonumber(ARGV[1]), redis.call('PTTL', KEYS[2])))
+end
+return level
+`)
+
+// WatchableStorage is implemented by storages able to notify state changes made by other instances
+type WatchableStorage interface {
+	Storage
+	// Watch calls fn with persisted state each time it changes, until ctx is done.
+	// Returns an error when changes can not be watched anymore
+	Watch(ctx context.Context, fn func(state State)) error
+}
+
+// RedisOptions RedisStorage settings.
+type RedisOptions struct {
+	// Name saves keys like prefix:{name}:state, so every instance using the same name shares the circuit.
+	// Keys are built from Key if empty
+	Name string
+	// Prefix of keys when Name is set. DefaultRedisPrefix by default
+	Prefix string
+	// Key to save keys like key_STATE when Name is not set. Generated by default
+	Key *xid.ID
+	// HashTag saves keys built from Key like {key}_STATE, so all of them go to the same Redis Cluster slot.
+	// Disabled by default, as enabling it renames keys already saved by instances without it
+	HashTag bool
+	// IdleTTL expiration time of keys, refreshed on each write, so state of abandoned circuit breakers expires.
+	// Open state is kept until its period ends even if longer. Disabled by default
+	IdleTTL time.Duration
 }
 
 // RedisStorage to save circuit breaker current status using redis
 type RedisStorage struct {
-	key    xid.ID
-	client redis.Cmdable
+	key     xid.ID
+	hashTag bool
+	name    string
+	prefix  string
+	ttl     time.Duration
+	client  RedisClient
+	// oldest time window bucket asked by GetCounts, and latest one incremented, to remove older buckets
+	oldest int64
+	latest int64
 }
 
 // NewRedisStorage returns a RedisStorage object
 func NewRedisStorage(client redis.Cmdable, key *xid.ID) *RedisStorage {
-	cbKey := xid.New()
-	if key != nil {
-		cbKey = *key
+	// Options without name are always valid
+	rs, _ := NewRedisStorageWithOptions(client, &RedisOptions{Key: key})
+
+	return rs
+}
+
+// NewNamedRedisStorage returns a RedisStorage object saving keys like prefix:{name}:state,
+// so every instance using the same name shares the circuit. DefaultRedisPrefix is used if prefix is empty.
+// Name is enclosed in braces as a hash tag, so all keys of a circuit breaker go to the same Redis Cluster slot.
+// It fails with InvalidNameError if name is empty or has braces
+func NewNamedRedisStorage(client redis.Cmdable, name string, prefix string) (*RedisStorage, error) {
+	if name == "" {
+		return nil, errors.Wrap(InvalidNameError, "NewNamedRedisStorage -> empty name")
 	}
 
+	return NewRedisStorageWithOptions(client, &RedisOptions{Name: name, Prefix: prefix})
+}
+
+// MustNewNamedRedisStorage is like NewNamedRedisStorage but panics if name is not valid.
+// It simplifies building storages from known names, like in RegistryOptions
+func MustNewNamedRedisStorage(client redis.Cmdable, name string, prefix string) *RedisStorage {
+	rs, err := NewNamedRedisStorage(client, name, prefix)
+	if err != nil {
+		panic(err)
+	}
+
+	return rs
+}
+
+// NewRedisStorageWithOptions returns a RedisStorage object configured by options.
+// Cluster, Ring and Sentinel failover clients are used as any other client
+func NewRedisStorageWithOptions(client redis.Cmdable, options *RedisOptions) (*RedisStorage, error) {
+	return NewRedisClientStorage(&cmdableClient{client: client}, options)
+}
+
+// NewRedisClientStorage returns a RedisStorage object using any client library through RedisClient.
+// It fails with InvalidNameError if Name has braces
+func NewRedisClientStorage(client RedisClient, options *RedisOptions) (*RedisStorage, error) {
 	rs := RedisStorage{
-		key:    cbKey,
+		key:    xid.New(),
 		client: client,
 	}
 
-	return &rs
+	if options == nil {
+		return &rs, nil
+	}
+
+	if err := rs.withName(options.Name, options.Prefix); err != nil {
+		return nil, err
+	}
+
+	if options.Key != nil {
+		rs.key = *options.Key
+	}
+
+	if options.IdleTTL > 0 {
+		rs.ttl = options.IdleTTL
+	}
+
+	rs.hashTag = options.HashTag
+
+	return &rs, nil
+}
+
+// withName sets name and prefix of keys, DefaultRedisPrefix if empty. Keys are built from key if name is empty.
+// It fails with InvalidNameError if name has braces
+func (rs *RedisStorage) withName(name string, prefix string) error {
+	if strings.ContainsAny(name, "{}") {
+		return errors.Wrapf(InvalidNameError, "NewRedisStorage -> %q", name)
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	rs.name = name
+	rs.prefix = prefix
+	if prefix == "" {
+		rs.prefix = DefaultRedisPrefix
+	}
+
+	return nil
 }
 
 // GetCurrentState returns current circuit breaker state
-func (rs *RedisStorage) GetCurrentState() (State, error) {
-	key := rs.getStateKey()
-	value, err := rs.client.Get(key).Result()
-	if err == redis.Nil {
+func (rs *RedisStorage) GetCurrentState(ctx context.Context) (State, error) {
+	value, err := rs.client.Get(ctx, rs.getStateKey())
+	if err == RedisNilError {
 		return NewClosed(), nil
 	}
 
@@ -60,9 +286,7 @@ func (rs *RedisStorage) GetCurrentState() (State, error) {
 	}
 
 	if value == stateOpen {
-		ticker := clock.New()
-
-		return NewOpen(ticker), nil
+		return rs.getOpenState(ctx)
 	}
 
 	if value == stateHalfOpen {
@@ -72,22 +296,210 @@ func (rs *RedisStorage) GetCurrentState() (State, error) {
 	return NewClosed(), nil
 }
 
-// SetCurrentState persists the state
-func (rs *RedisStorage) SetCurrentState(state State) error {
-	key := rs.getStateKey()
-	err := rs.client.Set(key, fmt.Sprint(state), 0).Err()
+// getOpenState restores open state with its persisted expiration time.
+// When expiration time is not found, open state is considered expired
+func (rs *RedisStorage) getOpenState(ctx context.Context) (State, error) {
+	value, err := rs.client.Get(ctx, rs.getOpenUntilKey())
+	if err != nil && err != RedisNilError {
+		return NewClosed(), errors.Wrap(err, "RedisStorage -> GetCurrentState -> OpenUntil")
+	}
+
+	state, err := parseState(stateOpen, value)
+	if err != nil {
+		return state, errors.Wrap(err, "RedisStorage -> GetCurrentState -> OpenUntil -> Conversion")
+	}
+
+	return state, nil
+}
 
+// SetCurrentState persists the state. Expiration time is persisted too for open state, expiring when open state ends.
+// State is published on transitions channel
+func (rs *RedisStorage) SetCurrentState(ctx context.Context, state State) error {
+	err := rs.setCurrentState(ctx, state)
 	if err != nil {
 		return errors.Wrap(err, "RedisStorage -> SetCurrentState")
 	}
 
+	// Publishing is best effort, watchers fall back to polling
+	_ = rs.client.Publish(ctx, rs.getTransitionsKey(), state.String())
+
 	return nil
 }
 
+// setCurrentState persists the state, with expiration time for open state
+func (rs *RedisStorage) setCurrentState(ctx context.Context, state State) error {
+	open, ok := state.(*Open)
+	if !ok || open.Until().IsZero() {
+		return rs.client.Set(ctx, rs.getStateKey(), fmt.Sprint(state), rs.ttl)
+	}
+
+	keys := []string{rs.getStateKey(), rs.getOpenUntilKey(), rs.getBackoffKey()}
+	_, err := openScript.run(ctx, rs.client, keys,
+		fmt.Sprint(state), openUntil(open), untilMillis(open), rs.stateTTL(open).Milliseconds())
+
+	return err
+}
+
+// Watch calls fn with persisted state each time a transition is published, until ctx is done.
+// Returns an error if client does not support pub/sub or subscription fails
+func (rs *RedisStorage) Watch(ctx context.Context, fn func(state State)) error {
+	subscription, err := rs.client.Subscribe(ctx, rs.getTransitionsKey())
+	if err != nil {
+		return errors.Wrap(err, "RedisStorage -> Watch -> Subscribe")
+	}
+	defer subscription.Close()
+
+	return rs.receive(ctx, subscription.Messages(), fn)
+}
+
+// receive calls fn with persisted state for each message, until ctx is done or messages are closed
+func (rs *RedisStorage) receive(ctx context.Context, messages <-chan string, fn func(state State)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-messages:
+			if !ok {
+				return errors.New("RedisStorage -> Watch -> subscription closed")
+			}
+
+			rs.notify(ctx, fn)
+		}
+	}
+}
+
+// notify calls fn with persisted state. Messages may be outdated, so the state is loaded from storage
+func (rs *RedisStorage) notify(ctx context.Context, fn func(state State)) {
+	if state, err := rs.GetCurrentState(ctx); err == nil {
+		fn(state)
+	}
+}
+
+// TransitionState persists to state and clears failures in a single Lua script, only if persisted state is still from.
+// Script is run by EVALSHA, falling back to EVAL when not loaded in server
+func (rs *RedisStorage) TransitionState(ctx context.Context, from, to State) (State, error) {
+	state, until, err := rs.transition(ctx, from, to)
+	if err != nil {
+		return from, errors.Wrap(err, "RedisStorage -> TransitionState")
+	}
+
+	if state == to.String() && until == openUntil(to) {
+		return to, nil
+	}
+
+	current, err := parseState(state, until)
+	if err != nil {
+		return current, errors.Wrap(err, "RedisStorage -> TransitionState -> Conversion")
+	}
+
+	return current, nil
+}
+
+// transition runs transitionScript, returning persisted state and open state expiration time
+func (rs *RedisStorage) transition(ctx context.Context, from, to State) (string, string, error) {
+	keys := []string{rs.getStateKey(), rs.getOpenUntilKey(), rs.getFailuresKey()}
+	result, err := transitionScript.run(ctx, rs.client, keys, rs.transitionArgs(from, to)...)
+	if err != nil {
+		return "", "", err
+	}
+
+	values, _ := result.([]interface{})
+	if len(values) != 2 {
+		return "", "", errors.Errorf("unexpected result %v", result)
+	}
+
+	state, _ := values[0].(string)
+	until, _ := values[1].(string)
+
+	return state, until, nil
+}
+
+// transitionArgs returns transitionScript arguments: from state and its expiration time, to state and its
+// expiration time in nanoseconds and milliseconds, state and failures keys TTL in milliseconds and transitions channel
+func (rs *RedisStorage) transitionArgs(from, to State) []interface{} {
+	var until int64
+	stateTTL := rs.ttl
+	if open, ok := to.(*Open); ok && !open.Until().IsZero() {
+		until = untilMillis(open)
+		stateTTL = rs.stateTTL(open)
+	}
+
+	return []interface{}{
+		from.String(), openUntil(from),
+		to.String(), openUntil(to), until,
+		stateTTL.Milliseconds(), rs.ttl.Milliseconds(),
+		rs.getTransitionsKey(),
+	}
+}
+
+// stateTTL returns idle TTL of state key, extended to keep open state until its period ends. Zero if disabled
+func (rs *RedisStorage) stateTTL(open *Open) time.Duration {
+	if rs.ttl <= 0 {
+		return 0
+	}
+
+	if remaining := time.Until(open.Until()); remaining > rs.ttl {
+		return remaining
+	}
+
+	return rs.ttl
+}
+
+// touch refreshes idle TTL of key if set
+func (rs *RedisStorage) touch(ctx context.Context, key string) error {
+	if rs.ttl <= 0 {
+		return nil
+	}
+
+	return rs.client.PExpire(ctx, key, rs.ttl)
+}
+
+// openUntil returns expiration time of open state as saved in redis. Empty if not open or not started
+func openUntil(state State) string {
+	open, ok := state.(*Open)
+	if !ok || open.Until().IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(open.Until().UnixNano(), 10)
+}
+
+// untilMillis returns expiration time of open state as unix time in milliseconds
+func untilMillis(open *Open) int64 {
+	return open.Until().UnixNano() / int64(time.Millisecond)
+}
+
+// parseState returns state saved in redis, with expiration time for open state.
+// Open state without expiration time is considered expired
+func parseState(state string, until string) (State, error) {
+	ticker := clock.New()
+
+	switch state {
+	case stateOpen:
+		if until == "" {
+			return NewOpenUntil(ticker, ticker.Now()), nil
+		}
+
+		nanos, err := strconv.ParseInt(until, 10, 64)
+		if err != nil {
+			return NewClosed(), err
+		}
+
+		return NewOpenUntil(ticker, time.Unix(0, nanos)), nil
+	case stateHalfOpen:
+		return NewHalfOpen(), nil
+	default:
+		return NewClosed(), nil
+	}
+}
+
 // IncrementFailures increments failures count
-func (rs *RedisStorage) IncrementFailures() error {
+func (rs *RedisStorage) IncrementFailures(ctx context.Context) error {
 	key := rs.getFailuresKey()
-	err := rs.client.Incr(key).Err()
+	_, err := rs.client.Incr(ctx, key)
+	if err == nil {
+		err = rs.touch(ctx, key)
+	}
 
 	if err != nil {
 		return errors.Wrap(err, "RedisStorage -> IncrementFailures")
@@ -97,9 +509,8 @@ func (rs *RedisStorage) IncrementFailures() error {
 }
 
 // GetFailures gets failures count
-func (rs *RedisStorage) GetFailures() (int, error) {
-	key := rs.getFailuresKey()
-	value, err := rs.client.Get(key).Result()
+func (rs *RedisStorage) GetFailures(ctx context.Context) (int, error) {
+	value, err := rs.client.Get(ctx, rs.getFailuresKey())
 	switch err {
 	case nil:
 		{
@@ -110,7 +521,7 @@ func (rs *RedisStorage) GetFailures() (int, error) {
 
 			return failures, nil
 		}
-	case redis.Nil:
+	case RedisNilError:
 		return defaultFailure, nil
 	default:
 		return defaultFailure, errors.Wrap(err, "RedisStorage -> GetFailures")
@@ -118,9 +529,8 @@ func (rs *RedisStorage) GetFailures() (int, error) {
 }
 
 // Clear sets failures counts to zero
-func (rs *RedisStorage) Clear() error {
-	key := rs.getFailuresKey()
-	err := rs.client.Set(key, defaultFailure, 0).Err()
+func (rs *RedisStorage) Clear(ctx context.Context) error {
+	err := rs.client.Set(ctx, rs.getFailuresKey(), defaultFailure, rs.ttl)
 
 	if err != nil {
 		return errors.Wrap(err, "RedisStorage -> Clear")
@@ -129,31 +539,257 @@ func (rs *RedisStorage) Clear() error {
 	return nil
 }
 
+// IncrementCounts adds counts to the time window bucket.
+// When this instance moves to a new bucket, buckets older than the oldest one asked by GetCounts are removed
+func (rs *RedisStorage) IncrementCounts(ctx context.Context, bucket int64, counts Counts) error {
+	key := rs.getWindowKey()
+	err := rs.incrementFields(ctx, key, bucket, counts)
+	if err == nil && atomic.SwapInt64(&rs.latest, bucket) != bucket {
+		err = rs.prune(ctx, key)
+	}
+
+	if err == nil {
+		err = rs.touch(ctx, key)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "RedisStorage -> IncrementCounts")
+	}
+
+	return nil
+}
+
+// incrementFields adds counts to the hash fields of bucket
+func (rs *RedisStorage) incrementFields(ctx context.Context, key string, bucket int64, counts Counts) error {
+	fields := map[string]int{
+		successesField: counts.Successes,
+		failuresField:  counts.Failures,
+		slowCallsField: counts.SlowCalls,
+	}
+
+	for name, amount := range fields {
+		if amount == 0 {
+			continue
+		}
+
+		err := rs.client.HIncrBy(ctx, key, getBucketField(bucket, name), int64(amount))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prune removes hash fields of buckets older than the oldest one asked by GetCounts
+func (rs *RedisStorage) prune(ctx context.Context, key string) error {
+	oldest := atomic.LoadInt64(&rs.oldest)
+	if oldest == 0 {
+		return nil
+	}
+
+	values, err := rs.client.HGetAll(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	_, expired, err := sumBucketFields(values, oldest)
+	if err != nil || len(expired) == 0 {
+		return errors.Wrap(err, "Conversion")
+	}
+
+	return errors.Wrap(rs.client.HDel(ctx, key, expired...), "HDel")
+}
+
+// GetCounts returns the sum of counts from oldest bucket on. Older buckets are removed by IncrementCounts,
+// so reading counts does not write
+func (rs *RedisStorage) GetCounts(ctx context.Context, oldest int64) (Counts, error) {
+	atomic.StoreInt64(&rs.oldest, oldest)
+
+	values, err := rs.client.HGetAll(ctx, rs.getWindowKey())
+	if err != nil {
+		return Counts{}, errors.Wrap(err, "RedisStorage -> GetCounts")
+	}
+
+	counts, _, err := sumBucketFields(values, oldest)
+	if err != nil {
+		return Counts{}, errors.Wrap(err, "RedisStorage -> GetCounts -> Conversion")
+	}
+
+	return counts, nil
+}
+
+// ClearCounts discards all time window buckets
+func (rs *RedisStorage) ClearCounts(ctx context.Context) error {
+	err := rs.client.Del(ctx, rs.getWindowKey())
+
+	if err != nil {
+		return errors.Wrap(err, "RedisStorage -> ClearCounts")
+	}
+
+	return nil
+}
+
+// IncrementBackoffLevel increments open state backoff level, returning the new one
+func (rs *RedisStorage) IncrementBackoffLevel(ctx context.Context) (int, error) {
+	keys := []string{rs.getBackoffKey(), rs.getStateKey()}
+	result, err := backoffScript.run(ctx, rs.client, keys, rs.ttl.Milliseconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "RedisStorage -> IncrementBackoffLevel")
+	}
+
+	level, ok := result.(int64)
+	if !ok {
+		return 0, errors.Errorf("RedisStorage -> IncrementBackoffLevel -> unexpected result %v", result)
+	}
+
+	return int(level), nil
+}
+
+// GetBackoffLevel returns open state backoff level
+func (rs *RedisStorage) GetBackoffLevel(ctx context.Context) (int, error) {
+	value, err := rs.client.Get(ctx, rs.getBackoffKey())
+	if err == RedisNilError {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "RedisStorage -> GetBackoffLevel")
+	}
+
+	level, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "RedisStorage -> GetBackoffLevel -> Conversion")
+	}
+
+	return level, nil
+}
+
+// ClearBackoffLevel sets open state backoff level to zero
+func (rs *RedisStorage) ClearBackoffLevel(ctx context.Context) error {
+	err := rs.client.Del(ctx, rs.getBackoffKey())
+
+	if err != nil {
+		return errors.Wrap(err, "RedisStorage -> ClearBackoffLevel")
+	}
+
+	return nil
+}
+
 func (rs *RedisStorage) getFailuresKey() string {
-	return fmt.Sprintf("%s_%s", rs.key.String(), failureKey)
+	return rs.getKey(failureKey)
 }
 
 func (rs *RedisStorage) getStateKey() string {
-	return fmt.Sprintf("%s_%s", rs.key.String(), stateKey)
+	return rs.getKey(stateKey)
+}
+
+func (rs *RedisStorage) getOpenUntilKey() string {
+	return rs.getKey(openUntilKey)
+}
+
+func (rs *RedisStorage) getBackoffKey() string {
+	return rs.getKey(backoffKey)
+}
+
+func (rs *RedisStorage) getWindowKey() string {
+	return rs.getKey(windowKey)
+}
+
+func (rs *RedisStorage) getTransitionsKey() string {
+	return rs.getKey(transitionsKey)
+}
+
+// getKey returns redis key of kind. Named storages use prefix:{name}:kind, else xid_KIND or {xid}_KIND if sharded
+func (rs *RedisStorage) getKey(kind string) string {
+	if rs.prefix == "" && rs.hashTag {
+		return fmt.Sprintf("{%s}_%s", rs.key.String(), kind)
+	}
+
+	if rs.prefix == "" {
+		return fmt.Sprintf("%s_%s", rs.key.String(), kind)
+	}
+
+	return fmt.Sprintf("%s:{%s}:%s", rs.prefix, rs.name, strings.ToLower(kind))
+}
+
+func getBucketField(bucket int64, name string) string {
+	return fmt.Sprintf("%d_%s", bucket, name)
+}
+
+// sumBucketFields sums time window hash values from oldest bucket on, returning older fields as expired
+func sumBucketFields(values map[string]string, oldest int64) (Counts, []string, error) {
+	var counts Counts
+	var expired []string
+
+	for field, value := range values {
+		bucket, name, err := parseBucketField(field)
+		if err != nil {
+			return Counts{}, nil, err
+		}
+
+		if bucket < oldest {
+			expired = append(expired, field)
+
+			continue
+		}
+
+		amount, err := strconv.Atoi(value)
+		if err != nil {
+			return Counts{}, nil, err
+		}
+
+		counts = addBucketField(counts, name, amount)
+	}
+
+	return counts, expired, nil
+}
+
+// parseBucketField returns bucket and counter name of a time window hash field
+func parseBucketField(field string) (int64, string, error) {
+	parts := strings.SplitN(field, "_", 2)
+	bucket, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return 0, "", errors.Errorf("invalid window field %q", field)
+	}
+
+	return bucket, parts[1], nil
+}
+
+// addBucketField adds amount to the counter with name
+func addBucketField(counts Counts, name string, amount int) Counts {
+	switch name {
+	case successesField:
+		counts.Successes += amount
+	case failuresField:
+		counts.Failures += amount
+	case slowCallsField:
+		counts.SlowCalls += amount
+	}
+
+	return counts
 }
 
 // MemoryStorage to save circuit breaker current status into memory.
 // Avoid using it in multi container services
 type MemoryStorage struct {
-	mu       sync.RWMutex
-	state    State
-	failures int
+	mu           sync.RWMutex
+	state        State
+	failures     int
+	buckets      map[int64]Counts
+	backoffLevel int
 }
 
 // NewMemoryStorage returns a MemoryStorage object
 func NewMemoryStorage() *MemoryStorage {
-	ms := MemoryStorage{}
+	ms := MemoryStorage{
+		buckets: make(map[int64]Counts),
+	}
 
 	return &ms
 }
 
 // GetCurrentState returns current circuit breaker state
-func (ms *MemoryStorage) GetCurrentState() (State, error) {
+func (ms *MemoryStorage) GetCurrentState(_ context.Context) (State, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
@@ -165,7 +801,7 @@ func (ms *MemoryStorage) GetCurrentState() (State, error) {
 }
 
 // SetCurrentState persists the state
-func (ms *MemoryStorage) SetCurrentState(state State) error {
+func (ms *MemoryStorage) SetCurrentState(_ context.Context, state State) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
@@ -175,7 +811,7 @@ func (ms *MemoryStorage) SetCurrentState(state State) error {
 }
 
 // IncrementFailures increments failures count
-func (ms *MemoryStorage) IncrementFailures() error {
+func (ms *MemoryStorage) IncrementFailures(_ context.Context) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
@@ -185,7 +821,7 @@ func (ms *MemoryStorage) IncrementFailures() error {
 }
 
 // GetFailures gets failures count
-func (ms *MemoryStorage) GetFailures() (int, error) {
+func (ms *MemoryStorage) GetFailures(_ context.Context) (int, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
@@ -193,7 +829,7 @@ func (ms *MemoryStorage) GetFailures() (int, error) {
 }
 
 // Clear sets failures counts to zero
-func (ms *MemoryStorage) Clear() error {
+func (ms *MemoryStorage) Clear(_ context.Context) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
@@ -201,3 +837,70 @@ func (ms *MemoryStorage) Clear() error {
 
 	return nil
 }
+
+// IncrementCounts adds counts to the time window bucket
+func (ms *MemoryStorage) IncrementCounts(_ context.Context, bucket int64, counts Counts) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.buckets[bucket] = ms.buckets[bucket].add(counts)
+
+	return nil
+}
+
+// GetCounts returns the sum of counts from oldest bucket on. Older buckets are removed
+func (ms *MemoryStorage) GetCounts(_ context.Context, oldest int64) (Counts, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var counts Counts
+	for bucket, bucketCounts := range ms.buckets {
+		if bucket < oldest {
+			delete(ms.buckets, bucket)
+
+			continue
+		}
+
+		counts = counts.add(bucketCounts)
+	}
+
+	return counts, nil
+}
+
+// ClearCounts discards all time window buckets
+func (ms *MemoryStorage) ClearCounts(_ context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.buckets = make(map[int64]Counts)
+
+	return nil
+}
+
+// IncrementBackoffLevel increments open state backoff level, returning the new one
+func (ms *MemoryStorage) IncrementBackoffLevel(_ context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.backoffLevel++
+
+	return ms.backoffLevel, nil
+}
+
+// GetBackoffLevel returns open state backoff level
+func (ms *MemoryStorage) GetBackoffLevel(_ context.Context) (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.backoffLevel, nil
+}
+
+// ClearBackoffLevel sets open state backoff level to zero
+func (ms *MemoryStorage) ClearBackoffLevel(_ context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.backoffLevel = 0
+
+	return nil
+}
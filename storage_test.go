@@ -1,8 +1,12 @@
 package breaker_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,14 +18,16 @@ import (
 	"github.com/go-redis/redis"
 	"github.com/rs/xid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 const stateClosed string = "closed"
 
 func TestMemoryStorage_GetCurrentState(t *testing.T) {
+	ctx := context.Background()
 	ms := breaker.NewMemoryStorage()
 
-	currentState, err := ms.GetCurrentState()
+	currentState, err := ms.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := currentState.(*breaker.Closed)
@@ -29,12 +35,13 @@ func TestMemoryStorage_GetCurrentState(t *testing.T) {
 }
 
 func TestMemoryStorage_SetCurrentState(t *testing.T) {
+	ctx := context.Background()
 	ms := breaker.NewMemoryStorage()
 
-	err := ms.SetCurrentState(breaker.NewHalfOpen())
+	err := ms.SetCurrentState(ctx, breaker.NewHalfOpen())
 	assert.NoError(t, err)
 
-	currentState, err := ms.GetCurrentState()
+	currentState, err := ms.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := currentState.(*breaker.HalfOpen)
@@ -42,34 +49,81 @@ func TestMemoryStorage_SetCurrentState(t *testing.T) {
 }
 
 func TestMemoryStorage_IncrementFailures(t *testing.T) {
+	ctx := context.Background()
 	ms := breaker.NewMemoryStorage()
 
-	err := ms.IncrementFailures()
+	err := ms.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	failures, err := ms.GetFailures()
+	failures, err := ms.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, failures, 1)
 }
 
 func TestMemoryStorage_Clear(t *testing.T) {
+	ctx := context.Background()
 	ms := breaker.NewMemoryStorage()
 
-	err := ms.IncrementFailures()
+	err := ms.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	failures, err := ms.GetFailures()
+	failures, err := ms.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, failures)
 
-	err = ms.Clear()
+	err = ms.Clear(ctx)
 	assert.NoError(t, err)
 
-	failures, err = ms.GetFailures()
+	failures, err = ms.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 }
 
+func TestMemoryStorage_Counts(t *testing.T) {
+	ctx := context.Background()
+	ms := breaker.NewMemoryStorage()
+
+	for bucket := int64(1); bucket <= 3; bucket++ {
+		err := ms.IncrementCounts(ctx, bucket, breaker.Counts{Successes: 1, Failures: 2, SlowCalls: 1})
+		assert.NoError(t, err)
+	}
+
+	counts, err := ms.GetCounts(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 2, Failures: 4, SlowCalls: 2}, counts)
+
+	counts, err = ms.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 2, Failures: 4, SlowCalls: 2}, counts)
+
+	err = ms.ClearCounts(ctx)
+	assert.NoError(t, err)
+
+	counts, err = ms.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{}, counts)
+}
+
+func TestMemoryStorage_BackoffLevel(t *testing.T) {
+	ctx := context.Background()
+	ms := breaker.NewMemoryStorage()
+
+	level, err := ms.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = ms.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, level)
+
+	err = ms.ClearBackoffLevel(ctx)
+	assert.NoError(t, err)
+
+	level, err = ms.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+}
+
 func newTestRedis() *redismock.ClientMock {
 	mr, err := miniredis.Run()
 	if err != nil {
@@ -84,13 +138,14 @@ func newTestRedis() *redismock.ClientMock {
 }
 
 func TestRedisStorage_GetCurrentState(t *testing.T) {
+	ctx := context.Background()
 	client := newTestRedis()
 	key := xid.New()
 	stateKey := fmt.Sprintf("%s_%s", key.String(), "STATE")
 
 	rs := breaker.NewRedisStorage(client, nil)
 
-	currentState, err := rs.GetCurrentState()
+	currentState, err := rs.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok := currentState.(*breaker.Closed)
@@ -101,7 +156,7 @@ func TestRedisStorage_GetCurrentState(t *testing.T) {
 
 	rs = breaker.NewRedisStorage(client, &key)
 
-	currentState, err = rs.GetCurrentState()
+	currentState, err = rs.GetCurrentState(ctx)
 	assert.Error(t, err, "RedisStorage -> GetCurrentState")
 
 	_, ok = currentState.(*breaker.Closed)
@@ -109,33 +164,34 @@ func TestRedisStorage_GetCurrentState(t *testing.T) {
 }
 
 func TestRedisStorage_SetCurrentState(t *testing.T) {
+	ctx := context.Background()
 	client := newTestRedis()
 	key := xid.New()
 	stateKey := fmt.Sprintf("%s_%s", key.String(), "STATE")
 
 	rs := breaker.NewRedisStorage(client, nil)
 
-	err := rs.SetCurrentState(breaker.NewClosed())
+	err := rs.SetCurrentState(ctx, breaker.NewClosed())
 	assert.NoError(t, err)
 
-	currentState, err := rs.GetCurrentState()
+	currentState, err := rs.GetCurrentState(ctx)
 	assert.NoError(t, err)
 	_, ok := currentState.(*breaker.Closed)
 	assert.True(t, ok)
 
-	err = rs.SetCurrentState(breaker.NewHalfOpen())
+	err = rs.SetCurrentState(ctx, breaker.NewHalfOpen())
 	assert.NoError(t, err)
 
-	currentState, err = rs.GetCurrentState()
+	currentState, err = rs.GetCurrentState(ctx)
 	assert.NoError(t, err)
 	_, ok = currentState.(*breaker.HalfOpen)
 	assert.True(t, ok)
 
 	ticker := clock.New()
-	err = rs.SetCurrentState(breaker.NewOpen(ticker))
+	err = rs.SetCurrentState(ctx, breaker.NewOpen(ticker))
 	assert.NoError(t, err)
 
-	currentState, err = rs.GetCurrentState()
+	currentState, err = rs.GetCurrentState(ctx)
 	assert.NoError(t, err)
 
 	_, ok = currentState.(*breaker.Open)
@@ -145,11 +201,56 @@ func TestRedisStorage_SetCurrentState(t *testing.T) {
 		Return(redis.NewStatusResult("", errors.New("server not available")))
 
 	rs = breaker.NewRedisStorage(client, &key)
-	err = rs.SetCurrentState(breaker.NewClosed())
+	err = rs.SetCurrentState(ctx, breaker.NewClosed())
 	assert.Error(t, err, "RedisStorage -> SetCurrentState")
 }
 
+func TestRedisStorage_OpenUntil(t *testing.T) {
+	ctx := context.Background()
+	key := xid.New()
+	openUntilKey := fmt.Sprintf("%s_%s", key.String(), "OPEN_UNTIL")
+	until := time.Now().Add(time.Minute).Round(0)
+
+	client := newTestRedis()
+
+	rs := breaker.NewRedisStorage(client, &key)
+
+	err := rs.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), until))
+	assert.NoError(t, err)
+
+	currentState, err := breaker.NewRedisStorage(client, &key).GetCurrentState(ctx)
+	assert.NoError(t, err)
+
+	open, ok := currentState.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, until.Equal(open.Until()))
+
+	nextState, err := open.Next(ctx, rs, &breaker.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, open, nextState)
+
+	err = client.Del(openUntilKey).Err()
+	assert.NoError(t, err)
+
+	currentState, err = rs.GetCurrentState(ctx)
+	assert.NoError(t, err)
+
+	nextState, err = currentState.Next(ctx, rs, &breaker.Options{})
+	assert.NoError(t, err)
+	_, ok = nextState.(*breaker.HalfOpen)
+	assert.True(t, ok)
+
+	err = client.Set(openUntilKey, "INVALID INTEGER VALUE", 0).Err()
+	assert.NoError(t, err)
+
+	currentState, err = rs.GetCurrentState(ctx)
+	assert.Error(t, err, "RedisStorage -> GetCurrentState -> OpenUntil -> Conversion")
+	_, ok = currentState.(*breaker.Closed)
+	assert.True(t, ok)
+}
+
 func TestRedisStorage_IncrementFailures(t *testing.T) {
+	ctx := context.Background()
 	key := xid.New()
 	failuresKey := fmt.Sprintf("%s_%s", key.String(), "FAILURES")
 
@@ -157,10 +258,10 @@ func TestRedisStorage_IncrementFailures(t *testing.T) {
 
 	rs := breaker.NewRedisStorage(client, &key)
 
-	err := rs.IncrementFailures()
+	err := rs.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	failures, err := rs.GetFailures()
+	failures, err := rs.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, failures)
 
@@ -169,11 +270,12 @@ func TestRedisStorage_IncrementFailures(t *testing.T) {
 
 	rs = breaker.NewRedisStorage(client, &key)
 
-	err = rs.IncrementFailures()
+	err = rs.IncrementFailures(ctx)
 	assert.Error(t, err, "RedisStorage -> IncrementFailures")
 }
 
 func TestRedisStorage_GetFailures(t *testing.T) {
+	ctx := context.Background()
 	key := xid.New()
 	failuresKey := fmt.Sprintf("%s_%s", key.String(), "FAILURES")
 
@@ -181,7 +283,7 @@ func TestRedisStorage_GetFailures(t *testing.T) {
 
 	rs := breaker.NewRedisStorage(client, &key)
 
-	failures, err := rs.GetFailures()
+	failures, err := rs.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
@@ -190,7 +292,7 @@ func TestRedisStorage_GetFailures(t *testing.T) {
 
 	rs = breaker.NewRedisStorage(client, &key)
 
-	failures, err = rs.GetFailures()
+	failures, err = rs.GetFailures(ctx)
 	assert.Error(t, err, "RedisStorage -> GetFailures")
 	assert.Equal(t, 0, failures)
 
@@ -200,15 +302,16 @@ func TestRedisStorage_GetFailures(t *testing.T) {
 
 	rs = breaker.NewRedisStorage(client, &key)
 
-	err = rs.IncrementFailures()
+	err = rs.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	failures, err = rs.GetFailures()
+	failures, err = rs.GetFailures(ctx)
 	assert.Error(t, err, "RedisStorage -> GetFailures -> Conversion")
 	assert.Equal(t, 0, failures)
 }
 
 func TestRedisStorage_Clear(t *testing.T) {
+	ctx := context.Background()
 	key := xid.New()
 	client := newTestRedis()
 	failuresKey := fmt.Sprintf("%s_%s", key.String(), "FAILURES")
@@ -216,13 +319,13 @@ func TestRedisStorage_Clear(t *testing.T) {
 
 	rs := breaker.NewRedisStorage(client, &key)
 
-	err := rs.IncrementFailures()
+	err := rs.IncrementFailures(ctx)
 	assert.NoError(t, err)
 
-	err = rs.Clear()
+	err = rs.Clear(ctx)
 	assert.NoError(t, err)
 
-	failures, err := rs.GetFailures()
+	failures, err := rs.GetFailures(ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, failures)
 
@@ -234,6 +337,453 @@ func TestRedisStorage_Clear(t *testing.T) {
 
 	rs = breaker.NewRedisStorage(client, &key)
 
-	err = rs.Clear()
+	err = rs.Clear(ctx)
 	assert.Error(t, err, "RedisStorage -> SetCurrentState")
 }
+
+func TestRedisStorage_Counts(t *testing.T) {
+	ctx := context.Background()
+	key := xid.New()
+	windowKey := fmt.Sprintf("%s_%s", key.String(), "WINDOW")
+
+	client := newTestRedis()
+
+	rs := breaker.NewRedisStorage(client, &key)
+
+	for bucket := int64(1); bucket <= 3; bucket++ {
+		err := rs.IncrementCounts(ctx, bucket, breaker.Counts{Successes: 1, Failures: 2, SlowCalls: 1})
+		assert.NoError(t, err)
+	}
+
+	counts, err := rs.GetCounts(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{Successes: 2, Failures: 4, SlowCalls: 2}, counts)
+
+	// Reading counts does not remove older buckets, moving to a new bucket does
+	fields, err := client.HKeys(windowKey).Result()
+	assert.NoError(t, err)
+	assert.Len(t, fields, 9)
+
+	err = rs.IncrementCounts(ctx, 3, breaker.Counts{Successes: 1})
+	assert.NoError(t, err)
+	fields, err = client.HKeys(windowKey).Result()
+	assert.NoError(t, err)
+	assert.Len(t, fields, 9)
+
+	err = rs.IncrementCounts(ctx, 4, breaker.Counts{Successes: 1})
+	assert.NoError(t, err)
+	fields, err = client.HKeys(windowKey).Result()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"2_SUCCESSES", "2_FAILURES", "2_SLOW_CALLS", "3_SUCCESSES", "3_FAILURES", "3_SLOW_CALLS", "4_SUCCESSES",
+	}, fields)
+
+	err = rs.ClearCounts(ctx)
+	assert.NoError(t, err)
+
+	counts, err = rs.GetCounts(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Counts{}, counts)
+
+	err = client.HSet(windowKey, "1_FAILURES", "INVALID INTEGER VALUE").Err()
+	assert.NoError(t, err)
+
+	counts, err = rs.GetCounts(ctx, 0)
+	assert.Error(t, err, "RedisStorage -> GetCounts -> Conversion")
+	assert.Equal(t, breaker.Counts{}, counts)
+
+	client.On("HGetAll", windowKey).
+		Return(redis.NewStringStringMapResult(nil, errors.New("server not available")))
+
+	_, err = rs.GetCounts(ctx, 0)
+	assert.Error(t, err, "RedisStorage -> GetCounts")
+}
+
+func TestRedisStorage_BackoffLevel(t *testing.T) {
+	ctx := context.Background()
+	key := xid.New()
+	backoffKey := fmt.Sprintf("%s_%s", key.String(), "BACKOFF_LEVEL")
+
+	client := newTestRedis()
+
+	rs := breaker.NewRedisStorage(client, &key)
+
+	level, err := rs.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = breaker.NewRedisStorage(client, &key).IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, level)
+
+	err = rs.ClearBackoffLevel(ctx)
+	assert.NoError(t, err)
+
+	level, err = rs.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = rs.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	client.On("Get", backoffKey).
+		Return(redis.NewStringResult("", errors.New("server not available")))
+	client.On("EvalSha", mock.Anything, mock.Anything, mock.Anything).
+		Return(redis.NewCmdResult(nil, errors.New("server not available")))
+
+	level, err = rs.GetBackoffLevel(ctx)
+	assert.Error(t, err, "RedisStorage -> GetBackoffLevel")
+	assert.Equal(t, 0, level)
+
+	level, err = rs.IncrementBackoffLevel(ctx)
+	assert.Error(t, err, "RedisStorage -> IncrementBackoffLevel")
+	assert.Equal(t, 0, level)
+}
+
+func TestRedisStorage_Context(t *testing.T) {
+	key := xid.New()
+	failuresKey := fmt.Sprintf("%s_%s", key.String(), "FAILURES")
+
+	client := newTestRedis()
+	client.On("Get", failuresKey).
+		Return(redis.NewStringResult("1", nil)).
+		WaitUntil(time.After(time.Second))
+
+	rs := breaker.NewRedisStorage(client, &key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	failures, err := rs.GetFailures(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 0, failures)
+
+	err = rs.IncrementFailures(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestNewNamedRedisStorage(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis()
+	until := time.Now().Add(time.Minute).Round(0)
+
+	rs := breaker.MustNewNamedRedisStorage(client, "payments", "")
+
+	err := rs.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), until))
+	assert.NoError(t, err)
+	err = rs.IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	state, err := client.Get("breaker:{payments}:state").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "open", state)
+
+	openUntil, err := client.Get("breaker:{payments}:open_until").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, until.UnixNano(), openUntil)
+
+	failures, err := client.Get("breaker:{payments}:failures").Int()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	currentState, err := breaker.MustNewNamedRedisStorage(client, "payments", breaker.DefaultRedisPrefix).GetCurrentState(ctx)
+	assert.NoError(t, err)
+	open, ok := currentState.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, until.Equal(open.Until()))
+
+	currentState, err = breaker.MustNewNamedRedisStorage(client, "payments", "app").GetCurrentState(ctx)
+	assert.NoError(t, err)
+	_, ok = currentState.(*breaker.Closed)
+	assert.True(t, ok)
+
+	err = breaker.MustNewNamedRedisStorage(client, "payments", "app").IncrementCounts(ctx, 1, breaker.Counts{Successes: 1})
+	assert.NoError(t, err)
+
+	successes, err := client.HGet("app:{payments}:window", "1_SUCCESSES").Int()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, successes)
+
+	_, err = breaker.NewNamedRedisStorage(client, "", "app")
+	assert.EqualError(t, err, "NewNamedRedisStorage -> empty name: breaker: invalid storage name")
+	_, err = breaker.NewNamedRedisStorage(client, "pay{ments}", "")
+	assert.True(t, errors.Is(err, breaker.InvalidNameError))
+	_, err = breaker.NewRedisStorageWithOptions(client, &breaker.RedisOptions{Name: "pay{ments}"})
+	assert.EqualError(t, err, `NewRedisStorage -> "pay{ments}": breaker: invalid storage name`)
+
+	assert.PanicsWithError(t, "NewNamedRedisStorage -> empty name: breaker: invalid storage name", func() {
+		breaker.MustNewNamedRedisStorage(client, "", "app")
+	})
+}
+
+func TestRedisStorage_TransitionState(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis()
+	ticker := clock.New()
+	until := time.Now().Add(time.Minute).Round(0)
+
+	rs := breaker.MustNewNamedRedisStorage(client, "payments", "")
+
+	err := rs.IncrementFailures(ctx)
+	assert.NoError(t, err)
+
+	open := breaker.NewOpenUntil(ticker, until)
+	state, err := rs.TransitionState(ctx, breaker.NewClosed(), open)
+	assert.NoError(t, err)
+	assert.Equal(t, open, state)
+
+	failures, err := rs.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	state, err = rs.TransitionState(ctx, breaker.NewClosed(), breaker.NewOpenUntil(ticker, until.Add(time.Minute)))
+	assert.NoError(t, err)
+	persisted, ok := state.(*breaker.Open)
+	assert.True(t, ok)
+	assert.True(t, until.Equal(persisted.Until()))
+
+	state, err = rs.TransitionState(ctx, breaker.NewOpenUntil(ticker, until.Add(-time.Minute)), breaker.NewHalfOpen())
+	assert.NoError(t, err)
+	_, ok = state.(*breaker.Open)
+	assert.True(t, ok)
+
+	halfOpen := breaker.NewHalfOpen()
+	state, err = rs.TransitionState(ctx, open, halfOpen)
+	assert.NoError(t, err)
+	assert.Equal(t, halfOpen, state)
+
+	client.On("EvalSha", mock.Anything, mock.Anything, mock.Anything).
+		Return(redis.NewCmdResult(nil, errors.New("server not available")))
+
+	state, err = rs.TransitionState(ctx, halfOpen, breaker.NewClosed())
+	assert.Error(t, err, "RedisStorage -> TransitionState")
+	assert.Equal(t, halfOpen, state)
+}
+
+func TestRedisStorage_IdleTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rs, err := breaker.NewRedisStorageWithOptions(client, &breaker.RedisOptions{Name: "payments", IdleTTL: time.Minute})
+	assert.NoError(t, err)
+
+	assert.NoError(t, rs.IncrementFailures(ctx))
+	assert.NoError(t, rs.IncrementCounts(ctx, 1, breaker.Counts{Failures: 1}))
+	_, err = rs.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, rs.SetCurrentState(ctx, breaker.NewHalfOpen()))
+
+	for _, key := range []string{"failures", "window", "backoff_level", "state"} {
+		assert.Equal(t, time.Minute, mr.TTL("breaker:{payments}:"+key), key)
+	}
+
+	mr.FastForward(time.Second * 30)
+	assert.NoError(t, rs.Clear(ctx))
+	assert.Equal(t, time.Minute, mr.TTL("breaker:{payments}:failures"))
+	assert.Equal(t, time.Second*30, mr.TTL("breaker:{payments}:state"))
+
+	mr.FastForward(time.Minute)
+	assert.False(t, mr.Exists("breaker:{payments}:state"))
+	assert.False(t, mr.Exists("breaker:{payments}:window"))
+
+	state, err := rs.GetCurrentState(ctx)
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.Closed)
+	assert.True(t, ok)
+
+	open := breaker.NewOpenUntil(clock.New(), time.Now().Add(time.Minute*10))
+	state, err = rs.TransitionState(ctx, breaker.NewClosed(), open)
+	assert.NoError(t, err)
+	assert.Equal(t, open, state)
+
+	assert.InDelta(t, time.Minute*10, mr.TTL("breaker:{payments}:open_until"), float64(time.Second))
+	assert.InDelta(t, time.Minute*10, mr.TTL("breaker:{payments}:state"), float64(time.Second))
+	assert.Equal(t, time.Minute, mr.TTL("breaker:{payments}:failures"))
+
+	// Backoff level lasts until open state period ends, whether it is incremented after the state is saved or before
+	_, err = rs.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute*10, mr.TTL("breaker:{payments}:backoff_level"), float64(time.Second))
+
+	orders, err := breaker.NewRedisStorageWithOptions(client, &breaker.RedisOptions{Name: "orders", IdleTTL: time.Minute})
+	assert.NoError(t, err)
+	_, err = orders.IncrementBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, orders.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), time.Now().Add(time.Minute*10))))
+	assert.InDelta(t, time.Minute*10, mr.TTL("breaker:{orders}:backoff_level"), float64(time.Second))
+
+	mr.FastForward(time.Minute * 2)
+	level, err := rs.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+
+	level, err = orders.GetBackoffLevel(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, level)
+}
+
+func TestRedisStorage_OpenUntilExpiration(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rs := breaker.MustNewNamedRedisStorage(client, "payments", "")
+
+	err = rs.SetCurrentState(ctx, breaker.NewOpenUntil(clock.New(), time.Now().Add(time.Minute)))
+	assert.NoError(t, err)
+
+	assert.InDelta(t, time.Minute, mr.TTL("breaker:{payments}:open_until"), float64(time.Second))
+	assert.Equal(t, time.Duration(0), mr.TTL("breaker:{payments}:state"))
+
+	mr.FastForward(time.Minute)
+	assert.False(t, mr.Exists("breaker:{payments}:open_until"))
+
+	state, err := rs.GetCurrentState(ctx)
+	assert.NoError(t, err)
+
+	state, err = state.Next(ctx, rs, &breaker.Options{})
+	assert.NoError(t, err)
+	_, ok := state.(*breaker.HalfOpen)
+	assert.True(t, ok)
+}
+
+func TestRedisStorage_Watch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rs := breaker.MustNewNamedRedisStorage(client, "payments", "")
+
+	states := make(chan breaker.State, 1)
+	go func() {
+		_ = rs.Watch(ctx, func(state breaker.State) {
+			states <- state
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return mr.PubSubNumSub("breaker:{payments}:transitions")["breaker:{payments}:transitions"] == 1
+	}, time.Second, time.Millisecond)
+
+	err = breaker.MustNewNamedRedisStorage(client, "payments", "").SetCurrentState(ctx, breaker.NewHalfOpen())
+	assert.NoError(t, err)
+
+	_, ok := (<-states).(*breaker.HalfOpen)
+	assert.True(t, ok)
+
+	err = breaker.MustNewNamedRedisStorage(newTestRedis(), "payments", "").Watch(ctx, func(breaker.State) {})
+	assert.Error(t, err, "RedisStorage -> Watch -> pub/sub not supported by client")
+}
+
+func TestRedisStorage_Cluster(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer client.Close()
+
+	key := xid.New()
+	options := breaker.Options{MaxFailures: 1, WindowSize: time.Minute, OpenStateBackoff: &breaker.ExponentialBackoff{}}
+
+	tagged, err := breaker.NewRedisStorageWithOptions(client, &breaker.RedisOptions{Key: &key, HashTag: true})
+	assert.NoError(t, err)
+
+	for _, rs := range []*breaker.RedisStorage{
+		tagged,
+		breaker.MustNewNamedRedisStorage(client, "payments", ""),
+	} {
+		b, err := breaker.New(rs, &options)
+		assert.NoError(t, err)
+
+		assert.NoError(t, b.Success())
+		assert.NoError(t, b.Fail())
+		assert.True(t, errors.Is(b.Ready(), breaker.OpenCircuitError))
+
+		state, err := rs.GetCurrentState(ctx)
+		assert.NoError(t, err)
+		_, ok := state.(*breaker.Open)
+		assert.True(t, ok)
+	}
+
+	// Keys of each circuit breaker share a hash tag, so they are in the same slot
+	tags := map[string]int{}
+	for _, k := range mr.Keys() {
+		tag := k[strings.Index(k, "{")+1 : strings.Index(k, "}")]
+		tags[tag]++
+	}
+	assert.Equal(t, map[string]int{key.String(): 5, "payments": 5}, tags)
+
+	// Without HashTag, keys keep their names
+	untagged := xid.New()
+	assert.NoError(t, breaker.NewRedisStorage(client, &untagged).IncrementFailures(ctx))
+	assert.True(t, mr.Exists(untagged.String()+"_FAILURES"))
+}
+
+func TestRedisStorage_Failover(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	master, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer master.Close()
+	replica, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer replica.Close()
+
+	// Dialer plays the role of sentinel, returning current master address
+	var addr atomic.Value
+	addr.Store(master.Addr())
+	client := redis.NewClient(&redis.Options{
+		Dialer: func() (net.Conn, error) {
+			return net.Dial("tcp", addr.Load().(string))
+		},
+		MaxRetries: 2,
+	})
+	defer client.Close()
+
+	rs := breaker.MustNewNamedRedisStorage(client, "payments", "")
+	states := make(chan breaker.State, 1)
+	go func() {
+		_ = rs.Watch(ctx, func(state breaker.State) {
+			states <- state
+		})
+	}()
+	assert.Eventually(t, func() bool {
+		return master.PubSubNumSub("breaker:{payments}:transitions")["breaker:{payments}:transitions"] == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, rs.IncrementFailures(ctx))
+
+	// Replica is promoted with master data
+	for _, k := range master.Keys() {
+		value, err := master.Get(k)
+		assert.NoError(t, err)
+		assert.NoError(t, replica.Set(k, value))
+	}
+	addr.Store(replica.Addr())
+	master.Close()
+
+	failures, err := rs.GetFailures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	assert.Eventually(t, func() bool {
+		return replica.PubSubNumSub("breaker:{payments}:transitions")["breaker:{payments}:transitions"] == 1
+	}, time.Second*3, time.Millisecond*10)
+
+	assert.NoError(t, rs.SetCurrentState(ctx, breaker.NewHalfOpen()))
+	_, ok := (<-states).(*breaker.HalfOpen)
+	assert.True(t, ok)
+}
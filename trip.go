@@ -0,0 +1,68 @@
+package breaker
+
+// TripStrategy decides when circuit goes from closed to open state
+type TripStrategy interface {
+	// ShouldTrip checks counts snapshot of closed state. Circuit opens when true
+	ShouldTrip(counts Counts) bool
+}
+
+// TripStrategyFunc is an adapter to use functions as TripStrategy
+type TripStrategyFunc func(counts Counts) bool
+
+// ShouldTrip calls f(counts)
+func (f TripStrategyFunc) ShouldTrip(counts Counts) bool {
+	return f(counts)
+}
+
+// ConsecutiveFailures opens the circuit when consecutive failures reach maxFailures
+func ConsecutiveFailures(maxFailures int) TripStrategy {
+	return TripStrategyFunc(func(counts Counts) bool {
+		return counts.ConsecutiveFailures >= maxFailures
+	})
+}
+
+// WindowFailures opens the circuit when failures in time window reach maxFailures. It requires WindowSize option
+func WindowFailures(maxFailures int) TripStrategy {
+	return TripStrategyFunc(func(counts Counts) bool {
+		return counts.Failures >= maxFailures
+	})
+}
+
+// FailureRate opens the circuit when the ratio of failures in time window reaches threshold,
+// once minRequests are counted. It requires WindowSize option
+func FailureRate(threshold float64, minRequests int) TripStrategy {
+	return TripStrategyFunc(func(counts Counts) bool {
+		requests := counts.Requests()
+		if requests == 0 || requests < minRequests {
+			return false
+		}
+
+		return float64(counts.Failures)/float64(requests) >= threshold
+	})
+}
+
+// SlowCallRate opens the circuit when the ratio of slow calls in time window reaches threshold,
+// once minRequests are counted. It requires WindowSize option
+func SlowCallRate(threshold float64, minRequests int) TripStrategy {
+	return TripStrategyFunc(func(counts Counts) bool {
+		requests := counts.Requests()
+		if requests == 0 || requests < minRequests {
+			return false
+		}
+
+		return float64(counts.SlowCalls)/float64(requests) >= threshold
+	})
+}
+
+// AnyOf opens the circuit when any of strategies does
+func AnyOf(strategies ...TripStrategy) TripStrategy {
+	return TripStrategyFunc(func(counts Counts) bool {
+		for _, strategy := range strategies {
+			if strategy.ShouldTrip(counts) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
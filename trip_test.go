@@ -0,0 +1,63 @@
+package breaker_test
+
+import (
+	"testing"
+
+	"github.com/francisco-alejandro/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsecutiveFailures(t *testing.T) {
+	strategy := breaker.ConsecutiveFailures(2)
+
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{ConsecutiveFailures: 1, Failures: 5}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{ConsecutiveFailures: 2}))
+}
+
+func TestWindowFailures(t *testing.T) {
+	strategy := breaker.WindowFailures(2)
+
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{Failures: 1, ConsecutiveFailures: 5}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{Failures: 2}))
+}
+
+func TestFailureRate(t *testing.T) {
+	strategy := breaker.FailureRate(0.5, 4)
+
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{}))
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{Failures: 3}))
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{Successes: 3, Failures: 2}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{Successes: 2, Failures: 2}))
+}
+
+func TestSlowCallRate(t *testing.T) {
+	strategy := breaker.SlowCallRate(0.5, 4)
+
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{}))
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{Failures: 3, SlowCalls: 3}))
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{Successes: 3, Failures: 2, SlowCalls: 2}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{Successes: 2, Failures: 2, SlowCalls: 2}))
+}
+
+func TestAnyOf(t *testing.T) {
+	strategy := breaker.AnyOf(breaker.ConsecutiveFailures(2), breaker.WindowFailures(3))
+
+	assert.False(t, strategy.ShouldTrip(breaker.Counts{ConsecutiveFailures: 1, Failures: 2}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{ConsecutiveFailures: 2}))
+	assert.True(t, strategy.ShouldTrip(breaker.Counts{Failures: 3}))
+	assert.False(t, breaker.AnyOf().ShouldTrip(breaker.Counts{Failures: 3}))
+}
+
+func TestTripStrategyFunc_ShouldTrip(t *testing.T) {
+	var snapshot breaker.Counts
+	strategy := breaker.TripStrategyFunc(func(counts breaker.Counts) bool {
+		snapshot = counts
+
+		return true
+	})
+
+	counts := breaker.Counts{Successes: 1, Failures: 2, ConsecutiveFailures: 1}
+	assert.True(t, strategy.ShouldTrip(counts))
+	assert.Equal(t, counts, snapshot)
+	assert.Equal(t, 3, snapshot.Requests())
+}